@@ -0,0 +1,217 @@
+package mip
+
+import (
+	"flag"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"apps-golden-file-tests/harness"
+	"github.com/nextmv-io/sdk/golden"
+	"gopkg.in/yaml.v2"
+)
+
+// manifestFile is the name of the manifest in the directory of an app that
+// configures its golden file tests. Apps with a manifest are discovered and
+// tested by TestApps instead of a main_test.go of their own.
+const manifestFile = "golden.yml"
+
+// app limits TestApps to a single app, e.g. in the workflow that tests one app
+// per job.
+var app = flag.String("app", "", "name of the app to test, all apps with a manifest if empty")
+
+// Manifest configures the golden file tests of an app. The inputs are read from
+// the inputs directory next to the manifest and the app runs in its directory
+// at the root of the repository.
+type Manifest struct {
+	// Command runs the app, e.g. "python3".
+	Command string `yaml:"command"`
+	// Entrypoint are the arguments of the command that start the app, relative
+	// to the directory of the app, e.g. ["main.py"].
+	Entrypoint []string `yaml:"entrypoint"`
+	// Args are the options passed to the app.
+	Args []string `yaml:"args"`
+	// InputFlag and OutputFlag pass the paths of the input and output files.
+	InputFlag  string `yaml:"input_flag"`
+	OutputFlag string `yaml:"output_flag"`
+	// TransientFields are replaced before the comparison. Without a
+	// replacement, the golden package replaces them by a stable value of
+	// their type.
+	TransientFields []TransientField `yaml:"transient_fields"`
+	// DedicatedComparison limits the comparison to these fields.
+	DedicatedComparison []string `yaml:"dedicated_comparison"`
+	// IgnoreStdOut ignores the output of the app on stdout.
+	IgnoreStdOut bool `yaml:"ignore_stdout"`
+	// Errors configures the tests of the inputs in the errors directory next
+	// to the manifest, on which the app must fail, e.g. because they are
+	// invalid. Without it, only the inputs are tested.
+	Errors *ErrorTests `yaml:"errors"`
+	// Suites are further tests of the app on the inputs in their directories
+	// next to the manifest, e.g. with other args.
+	Suites []Suite `yaml:"suites"`
+}
+
+// Suite configures the tests of the app on the inputs in a directory next to
+// the manifest, on top of the settings of the manifest.
+type Suite struct {
+	// Name is the directory of the inputs and the name of the subtest.
+	Name string `yaml:"name"`
+	// Args are passed to the app after the args of the manifest.
+	Args []string `yaml:"args"`
+	// ArgsMatrix runs the app once per entry on every input, with the entry
+	// appended to the args. Every run is compared against its own golden
+	// file, named after the entry.
+	ArgsMatrix [][]string `yaml:"args_matrix"`
+	// DedicatedComparison replaces the one of the manifest, if given.
+	DedicatedComparison []string `yaml:"dedicated_comparison"`
+	// IgnoreStdOut replaces the one of the manifest, if given.
+	IgnoreStdOut *bool `yaml:"ignore_stdout"`
+	// StderrGolden also compares what the app writes to stderr against the
+	// .stderr.golden file next to the input, e.g. to check the notes it logs.
+	StderrGolden bool `yaml:"stderr_golden"`
+}
+
+// ErrorTests configures the tests of the inputs on which an app must fail.
+// Instead of the output, what the app writes to stderr is compared against
+// the .stderr.golden file next to the input.
+type ErrorTests struct {
+	// ExitCode is the exit code with which the app must fail.
+	ExitCode int `yaml:"exit_code"`
+	// StderrReplacements are applied to stderr before it is compared, e.g. to
+	// remove the traceback in front of the error.
+	StderrReplacements []StderrReplacement `yaml:"stderr_replacements"`
+}
+
+// StderrReplacement replaces the matches of a regular expression in stderr.
+type StderrReplacement struct {
+	Regex       string `yaml:"regex"`
+	Replacement string `yaml:"replacement"`
+}
+
+// TransientField is a field of the output that changes between runs.
+type TransientField struct {
+	Key         string `yaml:"key"`
+	Replacement any    `yaml:"replacement"`
+}
+
+// hooks prepare apps that need more than their manifest before their tests,
+// e.g. a build, keyed by the name of the app. They are called with the
+// directory of the app.
+var hooks = map[string]func(t *testing.T, dir string){
+	"knapsack-java-ortools": buildJar,
+}
+
+// buildJar builds the main.jar of a maven app and removes it after the tests.
+func buildJar(t *testing.T, dir string) {
+	build := exec.Command("mvn", "package")
+	build.Dir = dir
+	if output, err := build.CombinedOutput(); err != nil {
+		t.Fatalf("error building the app: %v: %s", err, output)
+	}
+	t.Cleanup(func() {
+		if err := os.Remove(filepath.Join(dir, "main.jar")); err != nil {
+			t.Error(err)
+		}
+	})
+}
+
+func TestApps(t *testing.T) {
+	dirs, err := os.ReadDir(".")
+	if err != nil {
+		t.Fatalf("error reading directory: %v", err)
+	}
+	for _, dir := range dirs {
+		name := dir.Name()
+		if !dir.IsDir() || (*app != "" && name != *app) {
+			continue
+		}
+		content, err := os.ReadFile(filepath.Join(name, manifestFile))
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			t.Fatalf("error reading manifest: %v", err)
+		}
+		var manifest Manifest
+		if err := yaml.Unmarshal(content, &manifest); err != nil {
+			t.Fatalf("error unmarshalling manifest of %s: %v", name, err)
+		}
+
+		t.Run(name, func(t *testing.T) {
+			workDir := filepath.Join("..", "..", name)
+			if hook, ok := hooks[name]; ok {
+				hook(t, workDir)
+			}
+			harness.FileTests(t, filepath.Join(name, "inputs"), manifest.config(workDir))
+			if manifest.Errors != nil {
+				t.Run("errors", func(t *testing.T) {
+					harness.FileTests(t, filepath.Join(name, "errors"), manifest.errorConfig(workDir))
+				})
+			}
+			for _, suite := range manifest.Suites {
+				t.Run(suite.Name, func(t *testing.T) {
+					harness.FileTests(t, filepath.Join(name, suite.Name), manifest.suiteConfig(workDir, suite))
+				})
+			}
+		})
+	}
+}
+
+// config returns the configuration of the golden file tests of the app that
+// runs in the working directory.
+func (m Manifest) config(workDir string) harness.Config {
+	transientFields := make([]golden.TransientField, len(m.TransientFields))
+	for i, field := range m.TransientFields {
+		transientFields[i] = golden.TransientField{Key: field.Key, Replacement: field.Replacement}
+	}
+
+	return harness.Config{
+		Config: golden.Config{
+			Args:                m.Args,
+			TransientFields:     transientFields,
+			DedicatedComparison: m.DedicatedComparison,
+			IgnoreStdOut:        m.IgnoreStdOut,
+			ExecutionConfig: &golden.ExecutionConfig{
+				Command:    m.Command,
+				Args:       slices.Clip(m.Entrypoint),
+				InputFlag:  m.InputFlag,
+				OutputFlag: m.OutputFlag,
+				WorkDir:    workDir,
+			},
+		},
+	}
+}
+
+// errorConfig returns the configuration of the tests of the inputs on which
+// the app that runs in the working directory must fail.
+func (m Manifest) errorConfig(workDir string) harness.Config {
+	config := m.config(workDir)
+	config.ExitCode = m.Errors.ExitCode
+	for _, replacement := range m.Errors.StderrReplacements {
+		config.StderrReplacements = append(config.StderrReplacements, golden.VolatileRegexReplacement{
+			Regex:       replacement.Regex,
+			Replacement: replacement.Replacement,
+		})
+	}
+
+	return config
+}
+
+// suiteConfig returns the configuration of the tests of the suite of the app
+// that runs in the working directory.
+func (m Manifest) suiteConfig(workDir string, suite Suite) harness.Config {
+	config := m.config(workDir)
+	config.Args = append(slices.Clip(m.Args), suite.Args...)
+	config.ArgsMatrix = suite.ArgsMatrix
+	if len(suite.DedicatedComparison) > 0 {
+		config.DedicatedComparison = suite.DedicatedComparison
+	}
+	if suite.IgnoreStdOut != nil {
+		config.IgnoreStdOut = *suite.IgnoreStdOut
+	}
+	config.StderrGolden = suite.StderrGolden
+
+	return config
+}
@@ -2,7 +2,10 @@ module apps-golden-file-tests
 
 go 1.22
 
-require github.com/nextmv-io/sdk v1.5.0
+require (
+	github.com/nextmv-io/sdk v1.5.0
+	gopkg.in/yaml.v2 v2.4.0
+)
 
 require (
 	github.com/sergi/go-diff v1.3.1 // indirect
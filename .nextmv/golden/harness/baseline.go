@@ -0,0 +1,43 @@
+package harness
+
+import "github.com/nextmv-io/sdk/golden"
+
+// BaselineFloatThreshold is the threshold for comparing the floats of the
+// outputs of the Go apps, the objective value among them, unless an app sets
+// its own.
+const BaselineFloatThreshold = 0.01
+
+// Baseline returns the config with the baseline that the golden file tests of
+// all Go apps share. The versions of the sdk and of the given modules, e.g.
+// "go-mip" or "nextroute", and the durations of the result and the run are
+// transient, and floats are compared with the BaselineFloatThreshold. The
+// transient fields of the config are kept and take precedence, as does a Float
+// threshold set in the config.
+func Baseline(config golden.Config, modules ...string) golden.Config {
+	baseline := []golden.TransientField{{Key: ".version.sdk", Replacement: golden.StableVersion}}
+	for _, module := range modules {
+		baseline = append(baseline, golden.TransientField{Key: ".version." + module, Replacement: golden.StableVersion})
+	}
+	baseline = append(baseline,
+		golden.TransientField{Key: ".statistics.result.duration", Replacement: golden.StableFloat},
+		golden.TransientField{Key: ".statistics.run.duration", Replacement: golden.StableFloat},
+	)
+
+	custom := map[string]bool{}
+	for _, field := range config.TransientFields {
+		custom[field.Key] = true
+	}
+	var fields []golden.TransientField
+	for _, field := range baseline {
+		if !custom[field.Key] {
+			fields = append(fields, field)
+		}
+	}
+	config.TransientFields = append(fields, config.TransientFields...)
+
+	if config.Thresholds.Float == 0 {
+		config.Thresholds.Float = BaselineFloatThreshold
+	}
+
+	return config
+}
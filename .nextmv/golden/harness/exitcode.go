@@ -0,0 +1,93 @@
+package harness
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/nextmv-io/sdk/golden"
+)
+
+// exitCodeTests runs the app on every input in the location and fails if it
+// does not exit with the exit code of the config. The golden package fails on
+// any exit code other than 0, so apps that are expected to fail, e.g. on an
+// invalid input, are run by the harness. Instead of the output, what the app
+// writes to stderr is compared against the .stderr.golden file next to the
+// input, like with StderrGolden, unless the golden comparison is skipped.
+func exitCodeTests(t *testing.T, location string, config Config) {
+	if config.ExecutionConfig == nil {
+		t.Fatal("an exit code other than 0 requires an execution config")
+	}
+	inputs, err := inputFiles(location)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if *reportDir != "" {
+		addExitCodeCases(t, inputs)
+	}
+	parent := t
+	for _, input := range inputs {
+		t.Run(filepath.Base(input), func(t *testing.T) {
+			t.Parallel()
+			stderr, exitCode, err := run(input, filepath.Join(t.TempDir(), "output.json"), config.Config)
+			if err == nil && exitCode != config.ExitCode {
+				err = fmt.Errorf("exit code: got %v; want %v\n%s", exitCode, config.ExitCode, stderr)
+			}
+			if err == nil && !config.SkipGoldenComparison {
+				err = compareStderr(stderr, stderrGoldenPath(input, config.Config), config.StderrReplacements)
+			}
+			if err != nil {
+				t.Error(err)
+				recordError(parent, input, err)
+			}
+		})
+	}
+}
+
+// run runs the app of the config on the input, like the golden package, and
+// returns what it writes to stderr and its exit code. The output is written to
+// the given path.
+func run(input, output string, config golden.Config) (string, int, error) {
+	execution := config.ExecutionConfig
+	inputPath, err := filepath.Abs(input)
+	if err != nil {
+		return "", 0, err
+	}
+	args := append(append([]string{}, execution.Args...), config.Args...)
+	if execution.InputFlag != "" && !config.UseStdIn {
+		args = append(args, execution.InputFlag, inputPath)
+	}
+	if execution.OutputFlag != "" {
+		args = append(args, execution.OutputFlag, output)
+	}
+	for i, arg := range args {
+		arg = strings.ReplaceAll(arg, golden.ArgInputReplacement, inputPath)
+		args[i] = strings.ReplaceAll(arg, golden.ArgOutputReplacement, output)
+	}
+
+	command := exec.Command(execution.Command, args...)
+	command.Dir = execution.WorkDir
+	if config.UseStdIn {
+		f, err := os.Open(inputPath)
+		if err != nil {
+			return "", 0, err
+		}
+		defer f.Close()
+		command.Stdin = f
+	}
+	var stderr bytes.Buffer
+	command.Stderr = &stderr
+	err = command.Run()
+	var exitErr *exec.ExitError
+	if err != nil && !errors.As(err, &exitErr) {
+		return "", 0, err
+	}
+
+	return stderr.String(), command.ProcessState.ExitCode(), nil
+}
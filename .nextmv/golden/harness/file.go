@@ -0,0 +1,25 @@
+package harness
+
+import (
+	"flag"
+	"fmt"
+	"os"
+)
+
+// CompareFile compares the content against the golden file at the path, e.g.
+// a file that an app writes on top of its output. It returns an error if they
+// differ. The golden file is updated with -update.
+func CompareFile(content []byte, goldenPath string) error {
+	if flag.Lookup("update").Value.String() == "true" {
+		return os.WriteFile(goldenPath, content, 0o644)
+	}
+	expected, err := os.ReadFile(goldenPath)
+	if err != nil {
+		return err
+	}
+	if string(content) != string(expected) {
+		return fmt.Errorf("%s:\ngot:\n%s\nwant:\n%s", goldenPath, content, expected)
+	}
+
+	return nil
+}
@@ -0,0 +1,256 @@
+// Package harness extends the golden file tests of the sdk with the checks
+// that the apps of this repository share.
+package harness
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/nextmv-io/sdk/golden"
+)
+
+// Config configures the golden file tests of an app on top of the
+// configuration of the sdk.
+type Config struct {
+	golden.Config
+	// RunTwice runs the app twice on every input and fails if the two outputs
+	// differ, after the transient fields are replaced, before the output is
+	// compared against the golden file. It detects apps that are not
+	// deterministic. The check is skipped when the golden files are updated.
+	RunTwice bool
+	// Tolerances override the float threshold of the Thresholds for the
+	// values at their paths, e.g. a tight one for the objective and a loose
+	// one for derived quantities. Values without a tolerance fall back to the
+	// Float threshold.
+	Tolerances []Tolerance
+	// StderrGolden compares what the app writes to stderr against the
+	// .stderr.golden file next to the input, on top of the output, e.g. to
+	// check the warnings it logs. Log timestamps are removed before the
+	// comparison. The golden files are updated with -update.
+	StderrGolden bool
+	// StderrReplacements are applied to stderr before it is compared, e.g. to
+	// remove license warnings. They apply to the stderr of apps expected to
+	// exit with an ExitCode other than 0 too.
+	StderrReplacements []golden.VolatileRegexReplacement
+	// ArgsMatrix runs the app once per entry on every input, with the entry
+	// appended to the Args, e.g. [][]string{{"-solve.duration", "1s"},
+	// {"-solve.duration", "3s"}}. Every combination is compared against its
+	// own golden file next to the input, named after the arguments, e.g.
+	// input.solve.duration_1s.json.golden. Without a matrix, the app runs
+	// once with the Args.
+	ArgsMatrix [][]string
+}
+
+// Tolerance is the threshold for comparing the float at a path of the output,
+// and all floats nested below it. Paths are written like the keys of
+// transient fields, e.g. ".solutions[0].billable_weights"; a leading "$" is
+// ignored. If several paths match a value, the longest one applies.
+type Tolerance struct {
+	Path      string
+	Tolerance float64
+}
+
+// FileTests runs the golden file tests of the app on the inputs in the
+// location, like golden.FileTests. If the config expects an ExitCode other
+// than 0, the app must exit with it and its stderr is compared against golden
+// files instead of its output.
+func FileTests(t *testing.T, location string, config Config) {
+	if len(config.ArgsMatrix) == 0 {
+		fileTests(t, location, config)
+		return
+	}
+
+	inputs, err := inputFiles(location)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// With a working directory, the golden package resolves the inputs
+	// relative to the current directory.
+	cwd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, args := range config.ArgsMatrix {
+		name := argsName(args)
+		t.Run(name, func(t *testing.T) {
+			combination := config
+			combination.Args = append(append([]string{}, config.Args...), args...)
+			// The golden file is named after the input, so the input is
+			// copied to a name with the arguments, and the golden file is
+			// kept next to the original input.
+			dir := t.TempDir()
+			for _, input := range inputs {
+				b, err := os.ReadFile(input)
+				if err != nil {
+					t.Fatal(err)
+				}
+				base := strings.TrimSuffix(filepath.Base(input), ".json")
+				path := filepath.Join(dir, base+"."+name+".json")
+				if err := os.WriteFile(path, b, 0o600); err != nil {
+					t.Fatal(err)
+				}
+				if path, err = filepath.Rel(cwd, path); err != nil {
+					t.Fatal(err)
+				}
+				combination.OutputProcessConfig.RelativeDestination = filepath.Dir(input)
+				fileTests(t, path, combination)
+			}
+		})
+	}
+}
+
+// fileTests runs the golden file tests of the app with the arguments of the
+// config on the inputs in the location.
+func fileTests(t *testing.T, location string, config Config) {
+	if config.ExitCode != 0 {
+		exitCodeTests(t, location, config)
+		return
+	}
+	if len(config.Tolerances) > 0 {
+		thresholds, err := customFloatThresholds(location, config.Config, config.Tolerances)
+		if err != nil {
+			t.Fatal(err)
+		}
+		config.Thresholds.CustomThresholds.Float = thresholds
+	}
+	if *reportDir != "" {
+		reported, err := withReport(t, location, config.Config)
+		if err != nil {
+			t.Fatal(err)
+		}
+		config.Config = reported
+	}
+	if config.RunTwice {
+		t.Run("run-twice", func(t *testing.T) {
+			runTwice(t, location, config.Config)
+		})
+	}
+	if config.StderrGolden {
+		stderrFileTests(t, location, config)
+		return
+	}
+	golden.FileTests(t, location, config.Config)
+}
+
+// inputFiles returns the paths of the inputs in the location, the JSON files
+// in it and its subdirectories.
+func inputFiles(location string) ([]string, error) {
+	var inputs []string
+	err := filepath.WalkDir(location, func(path string, entry os.DirEntry, err error) error {
+		if err == nil && !entry.IsDir() && strings.HasSuffix(path, ".json") {
+			inputs = append(inputs, path)
+		}
+		return err
+	})
+
+	return inputs, err
+}
+
+// runTwice runs the app twice on the inputs in the location. The output of the
+// first run is written as the golden file to a temporary directory, the output
+// of the second run is compared against it with the same arguments, working
+// directory, transient fields and thresholds.
+func runTwice(t *testing.T, location string, config golden.Config) {
+	// The schema and the verification are checked by the regular run.
+	config.InputSchema, config.OutputSchema, config.VerifyFunc = nil, nil, nil
+	config.SkipGoldenComparison = false
+	config.OutputProcessConfig.RelativeDestination = t.TempDir()
+
+	first := config
+	first.OutputProcessConfig.AlwaysUpdate = true
+	t.Run("first", func(t *testing.T) {
+		golden.FileTests(t, location, first)
+	})
+	t.Run("second", func(t *testing.T) {
+		golden.FileTests(t, location, config)
+	})
+}
+
+// unsafeName matches the characters that are replaced in the names of the
+// golden files of an argument combination.
+var unsafeName = regexp.MustCompile(`[^A-Za-z0-9.-]+`)
+
+// argsName returns the name of an argument combination, used in the names of
+// the tests and golden files, e.g. "solve.duration_1s" for
+// []string{"-solve.duration", "1s"}.
+func argsName(args []string) string {
+	parts := make([]string, len(args))
+	for i, arg := range args {
+		parts[i] = unsafeName.ReplaceAllString(strings.TrimLeft(arg, "-"), "_")
+	}
+
+	return strings.Join(parts, "_")
+}
+
+// customFloatThresholds returns the custom float thresholds of the config,
+// extended by the tolerance of every key in the golden files of the location
+// that is matched by a tolerance. The golden package only supports thresholds
+// for exact keys, so the keys are taken from the golden files. Golden files
+// that do not exist yet are skipped.
+func customFloatThresholds(
+	location string,
+	config golden.Config,
+	tolerances []Tolerance,
+) (map[string]float64, error) {
+	thresholds := map[string]float64{}
+	for key, threshold := range config.Thresholds.CustomThresholds.Float {
+		thresholds[key] = threshold
+	}
+
+	err := filepath.WalkDir(location, func(path string, entry os.DirEntry, err error) error {
+		if err != nil || entry.IsDir() || !strings.HasSuffix(path, ".json") {
+			return err
+		}
+		file := goldenPath(path, config)
+		b, err := os.ReadFile(file)
+		if os.IsNotExist(err) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		var output any
+		if err := json.Unmarshal(b, &output); err != nil {
+			return fmt.Errorf("golden file %s: %w", file, err)
+		}
+		for key := range flatten(output) {
+			if tolerance, ok := matchTolerance(key, tolerances); ok {
+				thresholds[key] = tolerance
+			}
+		}
+		return nil
+	})
+
+	return thresholds, err
+}
+
+// goldenPath returns the path of the golden file of the input.
+func goldenPath(input string, config golden.Config) string {
+	if destination := config.OutputProcessConfig.RelativeDestination; destination != "" {
+		return filepath.Join(destination, filepath.Base(input)+".golden")
+	}
+
+	return input + ".golden"
+}
+
+// matchTolerance returns the tolerance with the longest path that matches the
+// key, i.e. the path is the key itself or one of its parents.
+func matchTolerance(key string, tolerances []Tolerance) (float64, bool) {
+	longest, tolerance := -1, 0.0
+	for _, t := range tolerances {
+		path := strings.TrimPrefix(t.Path, "$")
+		matches := key == path ||
+			strings.HasPrefix(key, path+".") ||
+			strings.HasPrefix(key, path+"[")
+		if matches && len(path) > longest {
+			longest, tolerance = len(path), t.Tolerance
+		}
+	}
+
+	return tolerance, longest >= 0
+}
@@ -0,0 +1,444 @@
+package harness
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"flag"
+	"fmt"
+	"html/template"
+	"math"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/nextmv-io/sdk/golden"
+)
+
+// reportDir is the directory to which the reports of the golden file tests
+// are written. No reports are written if it is empty. It defaults to the
+// GOLDEN_REPORT_DIR environment variable, which, unlike the flag, can be set
+// for test packages that do not use the harness.
+var reportDir = flag.String(
+	"report.dir",
+	os.Getenv("GOLDEN_REPORT_DIR"),
+	"directory to write the JUnit XML and HTML report of the golden file tests to",
+)
+
+// reportName is the name of the report files in the report directory, without
+// their extension. The test binaries of all apps write to the same files.
+const reportName = "golden"
+
+// report collects the results of the inputs of a test. It is merged into the
+// report files when the test and all its subtests are done.
+type report struct {
+	name string
+	mu   sync.Mutex
+	// cases are the results of the inputs, in the order they were added.
+	cases []*reportCase
+}
+
+// reportCase is the result of running the app on an input.
+type reportCase struct {
+	input      string
+	goldenPath string
+	config     golden.Config
+	output     []byte
+	// errors are the errors of the checks on the output, other than the
+	// comparison against the golden file.
+	errors []string
+	// changes are the paths whose values differ from the golden file.
+	changes []change
+	// exitCode is set for the inputs on which the app is expected to exit
+	// with an exit code other than 0. Their output is not evaluated, the
+	// test records its errors.
+	exitCode bool
+}
+
+// change is a value of the output that differs from the golden file. A
+// missing value is nil.
+type change struct {
+	Path     string
+	Expected any
+	Actual   any
+}
+
+var (
+	reportsMu sync.Mutex
+	reports   = map[*testing.T]*report{}
+)
+
+// reportFor returns the report of the test, and creates it and schedules it
+// to be written after the test if it does not exist yet.
+func reportFor(t *testing.T) *report {
+	reportsMu.Lock()
+	defer reportsMu.Unlock()
+	if r, ok := reports[t]; ok {
+		return r
+	}
+	// The tests of the apps share their names, e.g. TestGolden, so the name
+	// of the suite starts with the directory of the test package.
+	name := t.Name()
+	if cwd, err := os.Getwd(); err == nil {
+		name = filepath.Base(cwd) + "/" + name
+	}
+	r := &report{name: name}
+	reports[t] = r
+	t.Cleanup(func() {
+		reportsMu.Lock()
+		delete(reports, t)
+		reportsMu.Unlock()
+		if err := r.write(*reportDir); err != nil {
+			t.Error(err)
+		}
+	})
+
+	return r
+}
+
+// withReport returns the config in which the output of every input is
+// recorded in the report of the test.
+func withReport(t *testing.T, location string, config golden.Config) (golden.Config, error) {
+	r := reportFor(t)
+	cases := map[string]*reportCase{}
+	err := filepath.WalkDir(location, func(path string, entry os.DirEntry, err error) error {
+		if err != nil || entry.IsDir() || !strings.HasSuffix(path, ".json") {
+			return err
+		}
+		c := &reportCase{input: path, goldenPath: goldenPath(path, config), config: config}
+		cases[path] = c
+		r.mu.Lock()
+		r.cases = append(r.cases, c)
+		r.mu.Unlock()
+		return nil
+	})
+	if err != nil {
+		return config, err
+	}
+
+	verify := config.VerifyFunc
+	config.VerifyFunc = func(input, output []byte) error {
+		var err error
+		if verify != nil {
+			err = verify(input, output)
+		}
+		// The golden package calls the verification with the content of the
+		// input, so the case is found by it.
+		for path, c := range cases {
+			content, readErr := os.ReadFile(path)
+			if readErr != nil || string(content) != string(input) || c.output != nil {
+				continue
+			}
+			r.mu.Lock()
+			c.output = output
+			if err != nil {
+				c.errors = append(c.errors, err.Error())
+			}
+			r.mu.Unlock()
+			break
+		}
+		return err
+	}
+
+	return config, nil
+}
+
+// addExitCodeCases adds the inputs of a test on which the app is expected to
+// exit with an exit code other than 0 to the report of the test.
+func addExitCodeCases(t *testing.T, inputs []string) {
+	r := reportFor(t)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, input := range inputs {
+		r.cases = append(r.cases, &reportCase{input: input, exitCode: true})
+	}
+}
+
+// recordError adds the error of a check that the harness runs on top of the
+// golden package to the case of the input in the report of the test. Nothing
+// is recorded if no reports are written.
+func recordError(t *testing.T, input string, err error) {
+	if *reportDir == "" {
+		return
+	}
+	r := reportFor(t)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, c := range r.cases {
+		if c.input == input {
+			c.errors = append(c.errors, err.Error())
+			return
+		}
+	}
+}
+
+// evaluate compares the output of the case against its golden file and
+// validates it against the output schema.
+func (c *reportCase) evaluate() {
+	if c.exitCode {
+		return
+	}
+	if c.output == nil {
+		c.errors = append(c.errors, "the app did not produce an output")
+		return
+	}
+	if len(c.config.OutputSchema) > 0 {
+		if err := golden.ValidateAgainstSchema("output", c.output, c.config.OutputSchema); err != nil {
+			c.errors = append(c.errors, err.Error())
+		}
+	}
+	if c.config.SkipGoldenComparison {
+		return
+	}
+
+	var actual, expected any
+	if err := json.Unmarshal(c.output, &actual); err != nil {
+		c.errors = append(c.errors, fmt.Sprintf("output: %v", err))
+		return
+	}
+	b, err := os.ReadFile(c.goldenPath)
+	if err != nil {
+		c.errors = append(c.errors, err.Error())
+		return
+	}
+	if err := json.Unmarshal(b, &expected); err != nil {
+		c.errors = append(c.errors, fmt.Sprintf("golden file %s: %v", c.goldenPath, err))
+		return
+	}
+	c.changes = changes(flatten(expected), flatten(actual), c.config)
+}
+
+// failed returns whether the case failed.
+func (c *reportCase) failed() bool {
+	return len(c.errors) > 0 || len(c.changes) > 0
+}
+
+// changes returns the paths of the values that differ between the expected
+// and the actual output, sorted by path. Transient fields are ignored and
+// floats are compared with the thresholds of the config.
+func changes(expected, actual map[string]any, config golden.Config) []change {
+	transient := map[string]bool{}
+	for _, field := range config.TransientFields {
+		transient[field.Key] = true
+	}
+	paths := map[string]bool{}
+	if len(config.DedicatedComparison) > 0 {
+		for _, path := range config.DedicatedComparison {
+			paths[path] = true
+		}
+	} else {
+		for path := range expected {
+			paths[path] = true
+		}
+		for path := range actual {
+			paths[path] = true
+		}
+	}
+
+	var diff []change
+	for path := range paths {
+		if transient[path] {
+			continue
+		}
+		e, a := expected[path], actual[path]
+		if ef, ok := e.(float64); ok {
+			if af, ok := a.(float64); ok {
+				threshold := config.Thresholds.Float
+				if custom, ok := config.Thresholds.CustomThresholds.Float[path]; ok {
+					threshold = custom
+				}
+				if math.Abs(ef-af) <= threshold {
+					continue
+				}
+			}
+		}
+		if !reflect.DeepEqual(e, a) {
+			diff = append(diff, change{Path: path, Expected: e, Actual: a})
+		}
+	}
+	sort.Slice(diff, func(i, j int) bool { return diff[i].Path < diff[j].Path })
+
+	return diff
+}
+
+// flatten returns the values nested in the JSON value by their keys, in the
+// form of the golden package. Like there, empty arrays are kept as values and
+// empty objects are dropped.
+func flatten(value any) map[string]any {
+	flat := map[string]any{}
+	var walk func(prefix string, value any)
+	walk = func(prefix string, value any) {
+		switch value := value.(type) {
+		case map[string]any:
+			for key, child := range value {
+				walk(prefix+"."+key, child)
+			}
+		case []any:
+			if len(value) == 0 {
+				flat[prefix] = value
+			}
+			for i, child := range value {
+				walk(fmt.Sprintf("%s[%d]", prefix, i), child)
+			}
+		default:
+			flat[prefix] = value
+		}
+	}
+	walk("", value)
+
+	return flat
+}
+
+// junitTestSuites is the root of a JUnit XML report.
+type junitTestSuites struct {
+	XMLName xml.Name         `xml:"testsuites"`
+	Suites  []junitTestSuite `xml:"testsuite"`
+}
+
+type junitTestSuite struct {
+	Name     string          `xml:"name,attr"`
+	Tests    int             `xml:"tests,attr"`
+	Failures int             `xml:"failures,attr"`
+	Cases    []junitTestCase `xml:"testcase"`
+}
+
+type junitTestCase struct {
+	Name      string        `xml:"name,attr"`
+	ClassName string        `xml:"classname,attr"`
+	Failure   *junitFailure `xml:"failure,omitempty"`
+}
+
+type junitFailure struct {
+	Message string `xml:"message,attr"`
+	Text    string `xml:",chardata"`
+}
+
+// reportTemplate renders the HTML report of all tests.
+var reportTemplate = template.Must(template.New("report").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Golden file tests</title>
+<style>
+body { font-family: sans-serif; }
+.failed { color: #b00; }
+.passed { color: #080; }
+</style>
+</head>
+<body>
+<h1>Golden file tests</h1>
+{{range .Suites}}
+<h2>{{.Name}}: {{.Failures}} of {{.Tests}} failed</h2>
+{{range .Cases}}
+<h3 class="{{if .Failure}}failed{{else}}passed{{end}}">{{.Name}}: {{if .Failure}}failed{{else}}passed{{end}}</h3>
+{{with .Failure}}<pre>{{.Text}}</pre>
+{{end}}
+{{end}}
+{{end}}
+</body>
+</html>
+`))
+
+// suite returns the JUnit test suite of the report. A failed case lists its
+// errors and the paths whose values differ from the golden file, with the
+// expected and actual value.
+func (r *report) suite() junitTestSuite {
+	suite := junitTestSuite{Name: r.name, Tests: len(r.cases)}
+	for _, c := range r.cases {
+		c.evaluate()
+		testCase := junitTestCase{Name: filepath.Base(c.input), ClassName: r.name}
+		if c.failed() {
+			suite.Failures++
+			text := strings.Join(c.errors, "\n")
+			for _, ch := range c.changes {
+				text += fmt.Sprintf("\n%s: expected %v, actual %v", ch.Path, ch.Expected, ch.Actual)
+			}
+			testCase.Failure = &junitFailure{
+				Message: fmt.Sprintf("%d errors, %d changed paths", len(c.errors), len(c.changes)),
+				Text:    strings.TrimSpace(text),
+			}
+		}
+		suite.Cases = append(suite.Cases, testCase)
+	}
+
+	return suite
+}
+
+// write merges the report into the JUnit XML and HTML report in the
+// directory, replacing the suite of a previous run of the same test. The test
+// binaries of the apps run concurrently, so the report files are locked while
+// they are merged. Nothing is written if the directory is empty.
+func (r *report) write(dir string) error {
+	if dir == "" {
+		return nil
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	unlock, err := lockReport(dir)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	path := filepath.Join(dir, reportName)
+	var suites junitTestSuites
+	b, err := os.ReadFile(path + ".xml")
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if err == nil {
+		if err := xml.Unmarshal(b, &suites); err != nil {
+			return fmt.Errorf("report %s.xml: %w", path, err)
+		}
+	}
+	suite := r.suite()
+	suites.Suites = slices.DeleteFunc(suites.Suites, func(s junitTestSuite) bool {
+		return s.Name == suite.Name
+	})
+	suites.Suites = append(suites.Suites, suite)
+	sort.Slice(suites.Suites, func(i, j int) bool { return suites.Suites[i].Name < suites.Suites[j].Name })
+
+	b, err = xml.MarshalIndent(suites, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(path+".xml", append([]byte(xml.Header), b...), 0o644); err != nil {
+		return err
+	}
+
+	f, err := os.Create(path + ".html")
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	return reportTemplate.Execute(f, suites)
+}
+
+// lockReport acquires the lock of the report files in the directory and
+// returns the function that releases it. The lock is a file that only one
+// process can create.
+func lockReport(dir string) (func(), error) {
+	path := filepath.Join(dir, reportName+".lock")
+	for start := time.Now(); ; time.Sleep(10 * time.Millisecond) {
+		f, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o644)
+		if err == nil {
+			return func() {
+				_ = f.Close()
+				_ = os.Remove(path)
+			}, nil
+		}
+		if !os.IsExist(err) {
+			return nil, err
+		}
+		if time.Since(start) > time.Minute {
+			return nil, fmt.Errorf("waiting for the lock %s of the report, remove it if no tests are running", path)
+		}
+	}
+}
@@ -0,0 +1,88 @@
+package harness
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/nextmv-io/sdk/golden"
+)
+
+// logTimestamp matches the timestamp that the standard logger writes in front
+// of every line.
+const logTimestamp = `(?m)^\d{4}/\d{2}/\d{2} \d{2}:\d{2}:\d{2} `
+
+// teeStderr is the shell script that runs the command given as its arguments
+// and writes what the command writes to stderr to the file given as $0. The
+// stderr is passed on, so that the golden package still reports it if the
+// app fails.
+const teeStderr = `"$@" 2>"$0"; code=$?; cat "$0" >&2; exit $code`
+
+// stderrFileTests runs the golden file tests of the app on the inputs in the
+// location, like golden.FileTests, and compares what the app writes to stderr
+// in the same run against the .stderr.golden file next to the input. The
+// golden package does not expose stderr, so the app is wrapped to write it to
+// a file as well, which is compared when the test of the input is done.
+func stderrFileTests(t *testing.T, location string, config Config) {
+	if config.ExecutionConfig == nil {
+		t.Fatal("a stderr golden file requires an execution config")
+	}
+	inputs, err := inputFiles(location)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	for i, input := range inputs {
+		stderrPath := filepath.Join(dir, strconv.Itoa(i)+".stderr")
+		golden.FileTest(t, input, withStderr(config.Config, stderrPath))
+		t.Cleanup(func() {
+			stderr, err := os.ReadFile(stderrPath)
+			if os.IsNotExist(err) {
+				// The app did not run, which the test of the input reports.
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = compareStderr(string(stderr), stderrGoldenPath(input, config.Config), config.StderrReplacements)
+			if err != nil {
+				t.Error(err)
+				recordError(t, input, err)
+			}
+		})
+	}
+}
+
+// withStderr returns the config in which the app also writes what it writes
+// to stderr to the file at the path.
+func withStderr(config golden.Config, path string) golden.Config {
+	execution := *config.ExecutionConfig
+	execution.Args = append([]string{"-c", teeStderr, path, execution.Command}, execution.Args...)
+	execution.Command = "sh"
+	config.ExecutionConfig = &execution
+
+	return config
+}
+
+// stderrGoldenPath returns the path of the stderr golden file of the input.
+func stderrGoldenPath(input string, config golden.Config) string {
+	return strings.TrimSuffix(goldenPath(input, config), ".golden") + ".stderr.golden"
+}
+
+// compareStderr compares what the app wrote to stderr against the golden file
+// at the path, after the log timestamps are removed and the replacements are
+// applied, e.g. to remove license warnings. It returns an error if they
+// differ. The golden file is updated with -update.
+func compareStderr(stderr, goldenPath string, replacements []golden.VolatileRegexReplacement) error {
+	replacements = append([]golden.VolatileRegexReplacement{{Regex: logTimestamp}}, replacements...)
+	actual := stderr
+	for _, replacement := range replacements {
+		actual = regexp.MustCompile(replacement.Regex).ReplaceAllString(actual, replacement.Replacement)
+	}
+
+	return CompareFile([]byte(actual), goldenPath)
+}
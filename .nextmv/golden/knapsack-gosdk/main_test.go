@@ -1,46 +1,518 @@
 package mip
 
 import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math"
 	"os"
 	"testing"
 	"time"
 
+	"apps-golden-file-tests/harness"
 	"github.com/nextmv-io/sdk/golden"
 )
 
+// outputSchema is the JSON schema that every output of the app must satisfy.
+// It is validated on top of the golden comparison, so that structural changes
+// are caught even if the golden files are updated.
+var outputSchema []byte
+
 func TestMain(m *testing.M) {
+	var err error
+	outputSchema, err = os.ReadFile("output.schema.json")
+	if err != nil {
+		log.Fatal(err)
+	}
 	code := m.Run()
 	os.Exit(code)
 }
 
 func TestGolden(t *testing.T) {
-	t.Skip("skipping until we have a path forward for go-mip and go-highs")
-	golden.FileTests(
+	harness.FileTests(
 		t,
 		"inputs",
-		golden.Config{
-			Args: []string{
-				"-solve.duration", "3s",
-			},
-			TransientFields: []golden.TransientField{
-				{Key: ".version.sdk", Replacement: golden.StableVersion},
-				{Key: ".version.go-mip", Replacement: golden.StableVersion},
-				{Key: ".version.go-highs", Replacement: golden.StableVersion},
-				{Key: ".statistics.result.duration", Replacement: golden.StableFloat},
-				{Key: ".statistics.run.duration", Replacement: golden.StableFloat},
-			},
+		config(golden.Config{
 			Thresholds: golden.Tresholds{
-				Float:    0.01,
 				Time:     time.Duration(5) * time.Second,
 				Duration: time.Duration(5) * time.Second,
 			},
-			ExecutionConfig: &golden.ExecutionConfig{
-				Command:    "nextmv",
-				Args:       []string{"run", "."},
-				InputFlag:  "-runner.input.path",
-				OutputFlag: "-runner.output.path",
-				WorkDir:    "../../../knapsack-gosdk",
+		}),
+	)
+}
+
+// config completes the test specific configuration with the settings shared
+// by all tests: the app is run with a solve duration of 3s ahead of the given
+// arguments, and every output is validated against the output schema.
+func config(c golden.Config) harness.Config {
+	c.OutputSchema = outputSchema
+	c.Args = append([]string{"-solve.duration", "3s"}, c.Args...)
+	c.ExecutionConfig = &golden.ExecutionConfig{
+		Command:    "go",
+		Args:       []string{"run", "."},
+		InputFlag:  "-runner.input.path",
+		OutputFlag: "-runner.output.path",
+		WorkDir:    "../../../knapsack-gosdk",
+	}
+	return harness.Config{Config: harness.Baseline(c, "go-mip", "go-highs")}
+}
+
+// An item is an item of the input or of a solution.
+type item struct {
+	ID         string  `json:"id"`
+	Value      float64 `json:"value"`
+	Cost       float64 `json:"cost"`
+	Weight     float64 `json:"weight"`
+	Volume     float64 `json:"volume"`
+	Category   string  `json:"category"`
+	Min        int     `json:"min"`
+	Max        int     `json:"max"`
+	Required   bool    `json:"required"`
+	Quantity   int     `json:"quantity"`
+	KnapsackID *int    `json:"knapsack_id"`
+}
+
+// taken returns how many times the item is taken in a solution. The quantity
+// is only reported for items with bounds.
+func (i item) taken() int {
+	if i.Quantity > 0 {
+		return i.Quantity
+	}
+	return 1
+}
+
+// A synergy is a bonus for taking both items A and B.
+type synergy struct {
+	A     string  `json:"a"`
+	B     string  `json:"b"`
+	Bonus float64 `json:"bonus"`
+}
+
+// input is the part of the input of the app the verifications need.
+type input struct {
+	Items          []item         `json:"items"`
+	WeightCapacity float64        `json:"weight_capacity"`
+	Capacities     []float64      `json:"capacities"`
+	VolumeCapacity float64        `json:"volume_capacity"`
+	CategoryLimits map[string]int `json:"category_limits"`
+	Conflicts      [][2]string    `json:"conflicts"`
+	Synergies      []synergy      `json:"synergies"`
+}
+
+// solution is the part of a solution of the app the verifications need.
+type solution struct {
+	Items             []item    `json:"items"`
+	RemainingCapacity float64   `json:"remaining_capacity"`
+	Synergies         []synergy `json:"synergies"`
+}
+
+// output is the part of the output of the app the verifications need.
+type output struct {
+	Solutions  []solution `json:"solutions"`
+	Statistics struct {
+		Result struct {
+			Value  float64 `json:"value"`
+			Custom struct {
+				TotalCost      float64  `json:"total_cost"`
+				SecondaryValue *float64 `json:"secondary_value"`
+			} `json:"custom"`
+		} `json:"result"`
+	} `json:"statistics"`
+}
+
+// parse unmarshals the input and the output of a run and returns the input
+// and the first solution.
+func parse(in, out []byte) (input, solution, output, error) {
+	var i input
+	if err := json.Unmarshal(in, &i); err != nil {
+		return input{}, solution{}, output{}, err
+	}
+	var o output
+	if err := json.Unmarshal(out, &o); err != nil {
+		return input{}, solution{}, output{}, err
+	}
+	if len(o.Solutions) == 0 {
+		return input{}, solution{}, output{}, errors.New("output without solutions")
+	}
+	return i, o.Solutions[0], o, nil
+}
+
+// quantities returns how many times every item is taken across all
+// knapsacks.
+func quantities(s solution) map[string]int {
+	quantities := make(map[string]int, len(s.Items))
+	for _, item := range s.Items {
+		quantities[item.ID] += item.taken()
+	}
+	return quantities
+}
+
+func TestGoldenModelStatistics(t *testing.T) {
+	harness.FileTests(
+		t,
+		"model-statistics",
+		config(golden.Config{
+			Args: []string{
+				"-statistics.model",
+			},
+			// The input is a hand-built model with 3 variables, a single
+			// capacity constraint and coefficients between 0.5 and 4.
+			DedicatedComparison: []string{
+				".statistics.result.custom.model.variables",
+				".statistics.result.custom.model.constraints",
+				".statistics.result.custom.model.nonzeros",
+				".statistics.result.custom.model.density",
+				".statistics.result.custom.model.min_coefficient",
+				".statistics.result.custom.model.max_coefficient",
+			},
+		}),
+	)
+}
+
+func TestGoldenBounds(t *testing.T) {
+	harness.FileTests(
+		t,
+		"bounds",
+		config(golden.Config{
+			// Without its floor, the low-value sand would be dropped in favor
+			// of taking the gold twice. The floor forces it in, so the gold is
+			// taken once and the remaining capacity is filled with a pebble.
+			// Flour has a floor but no ceiling, so it fills the knapsack.
+			DedicatedComparison: []string{
+				".statistics.result.value",
+			},
+			VerifyFunc: verifyBounds,
+		}),
+	)
+}
+
+// verifyBounds checks that every item with bounds is taken at least its
+// minimum and at most its maximum number of times, and that the quantity is
+// reported for it.
+func verifyBounds(in, out []byte) error {
+	input, solution, _, err := parse(in, out)
+	if err != nil {
+		return err
+	}
+	taken := quantities(solution)
+	for _, item := range input.Items {
+		if taken[item.ID] < item.Min {
+			return fmt.Errorf("item %s taken %d times, want at least %d", item.ID, taken[item.ID], item.Min)
+		}
+		if item.Max > 0 && taken[item.ID] > item.Max {
+			return fmt.Errorf("item %s taken %d times, want at most %d", item.ID, taken[item.ID], item.Max)
+		}
+	}
+	for _, item := range solution.Items {
+		if (item.Min > 0 || item.Max > 0) && item.Quantity == 0 {
+			return fmt.Errorf("item %s with bounds without quantity", item.ID)
+		}
+	}
+	return nil
+}
+
+func TestGoldenKnapsacks(t *testing.T) {
+	harness.FileTests(
+		t,
+		"knapsacks",
+		config(golden.Config{
+			// The barrel and the crate fill the first knapsack, the anvil the
+			// second one. The drum fits in neither of them anymore.
+			DedicatedComparison: []string{
+				".statistics.result.value",
+				".solutions[0].remaining_capacity",
+				".solutions[0].unselected_items[0].id",
+			},
+			VerifyFunc: verifyKnapsacks,
+		}),
+	)
+}
+
+// verifyKnapsacks checks that every taken item reports the knapsack it is
+// packed into, that no knapsack is overloaded and that the remaining capacity
+// is what is left of all knapsacks.
+func verifyKnapsacks(in, out []byte) error {
+	input, solution, _, err := parse(in, out)
+	if err != nil {
+		return err
+	}
+	loads := make([]float64, len(input.Capacities))
+	remaining := 0.0
+	for _, capacity := range input.Capacities {
+		remaining += capacity
+	}
+	for _, item := range solution.Items {
+		if item.KnapsackID == nil || *item.KnapsackID < 0 || *item.KnapsackID >= len(loads) {
+			return fmt.Errorf("item %s without a valid knapsack_id", item.ID)
+		}
+		loads[*item.KnapsackID] += item.Weight * float64(item.taken())
+		remaining -= item.Weight * float64(item.taken())
+	}
+	for k, load := range loads {
+		if load > input.Capacities[k]+1e-6 {
+			return fmt.Errorf("knapsack %d loaded with %v, want at most %v", k, load, input.Capacities[k])
+		}
+	}
+	if math.Abs(solution.RemainingCapacity-remaining) > 1e-6 {
+		return fmt.Errorf("remaining capacity %v, want %v", solution.RemainingCapacity, remaining)
+	}
+	return nil
+}
+
+func TestGoldenVolume(t *testing.T) {
+	harness.FileTests(
+		t,
+		"volume",
+		config(golden.Config{
+			// All items fit by weight, but the pillow and the blanket do not
+			// fit together by volume. The pillow and the kettlebell are taken.
+			DedicatedComparison: []string{
+				".statistics.result.value",
+				".statistics.result.custom.weight_utilization",
+				".statistics.result.custom.volume_utilization",
 			},
-		},
+			VerifyFunc: verifyVolume,
+		}),
 	)
 }
+
+// verifyVolume checks that the taken items do not exceed the volume capacity.
+func verifyVolume(in, out []byte) error {
+	input, solution, _, err := parse(in, out)
+	if err != nil {
+		return err
+	}
+	volume := 0.0
+	for _, item := range solution.Items {
+		volume += item.Volume * float64(item.taken())
+	}
+	if volume > input.VolumeCapacity+1e-6 {
+		return fmt.Errorf("volume %v, want at most %v", volume, input.VolumeCapacity)
+	}
+	return nil
+}
+
+func TestGoldenCategoryLimits(t *testing.T) {
+	harness.FileTests(
+		t,
+		"category-limits",
+		config(golden.Config{
+			// All items fit, but only two fragile items may be taken. The
+			// lamp is left out in favor of the less valuable rug.
+			DedicatedComparison: []string{
+				".statistics.result.value",
+			},
+			VerifyFunc: verifyCategoryLimits,
+		}),
+	)
+}
+
+// verifyCategoryLimits checks that no more items of a category are taken than
+// its limit allows.
+func verifyCategoryLimits(in, out []byte) error {
+	input, solution, _, err := parse(in, out)
+	if err != nil {
+		return err
+	}
+	counts := make(map[string]int, len(input.CategoryLimits))
+	for _, item := range solution.Items {
+		counts[item.Category] += item.taken()
+	}
+	for category, limit := range input.CategoryLimits {
+		if counts[category] > limit {
+			return fmt.Errorf("%d items of category %s taken, want at most %d", counts[category], category, limit)
+		}
+	}
+	return nil
+}
+
+func TestGoldenConflicts(t *testing.T) {
+	harness.FileTests(
+		t,
+		"conflicts",
+		config(golden.Config{
+			// The bleach conflicts with the ammonia and the vinegar, which are
+			// worth more together. The knapsack is filled with the ammonia,
+			// the vinegar twice and the sponge.
+			DedicatedComparison: []string{
+				".statistics.result.value",
+			},
+			VerifyFunc: verifyConflicts,
+		}),
+	)
+}
+
+// verifyConflicts checks that no two conflicting items are taken together.
+func verifyConflicts(in, out []byte) error {
+	input, solution, _, err := parse(in, out)
+	if err != nil {
+		return err
+	}
+	taken := quantities(solution)
+	for _, conflict := range input.Conflicts {
+		if taken[conflict[0]] > 0 && taken[conflict[1]] > 0 {
+			return fmt.Errorf("conflicting items %s and %s taken together", conflict[0], conflict[1])
+		}
+	}
+	return nil
+}
+
+func TestGoldenRequired(t *testing.T) {
+	harness.FileTests(
+		t,
+		"required",
+		config(golden.Config{
+			// Without the required contract, the gold and the silver would
+			// be taken. The contract leaves room for the gold only.
+			DedicatedComparison: []string{
+				".statistics.result.value",
+			},
+			VerifyFunc: verifyRequired,
+		}),
+	)
+}
+
+// verifyRequired checks that every required item is taken.
+func verifyRequired(in, out []byte) error {
+	input, solution, _, err := parse(in, out)
+	if err != nil {
+		return err
+	}
+	taken := quantities(solution)
+	for _, item := range input.Items {
+		if item.Required && taken[item.ID] == 0 {
+			return fmt.Errorf("required item %s not taken", item.ID)
+		}
+	}
+	return nil
+}
+
+func TestGoldenCost(t *testing.T) {
+	harness.FileTests(
+		t,
+		"cost",
+		config(golden.Config{
+			// The painting is worth more, but the statue is more profitable.
+			// The crate has a negative profit and is left out despite the
+			// spare capacity, the required permit is taken regardless.
+			DedicatedComparison: []string{
+				".statistics.result.value",
+				".statistics.result.custom.total_cost",
+			},
+			VerifyFunc: verifyCost,
+		}),
+	)
+}
+
+// verifyCost checks that the total cost is the cost of the taken items and
+// that the objective value is their value net of that cost.
+func verifyCost(in, out []byte) error {
+	_, solution, output, err := parse(in, out)
+	if err != nil {
+		return err
+	}
+	value, cost := 0.0, 0.0
+	for _, item := range solution.Items {
+		value += item.Value * float64(item.taken())
+		cost += item.Cost * float64(item.taken())
+	}
+	if custom := output.Statistics.Result.Custom; math.Abs(custom.TotalCost-cost) > 1e-6 {
+		return fmt.Errorf("total cost %v, want %v", custom.TotalCost, cost)
+	}
+	if profit := output.Statistics.Result.Value; math.Abs(profit-(value-cost)) > 1e-6 {
+		return fmt.Errorf("value %v, want %v", profit, value-cost)
+	}
+	return nil
+}
+
+func TestGoldenSecondaryObjective(t *testing.T) {
+	harness.FileTests(
+		t,
+		"secondary-objective",
+		config(golden.Config{
+			Args: []string{
+				"-secondaryobjective", "min_weight",
+			},
+			// The trunk and the bag with the case are worth the same, but the
+			// bag and the case weigh less.
+			DedicatedComparison: []string{
+				".statistics.result.value",
+				".statistics.result.custom.secondary_value",
+				".solutions[0].remaining_capacity",
+			},
+			VerifyFunc: verifySecondaryObjective,
+		}),
+	)
+}
+
+// verifySecondaryObjective checks that the secondary value is the weight of
+// the taken items.
+func verifySecondaryObjective(in, out []byte) error {
+	_, solution, output, err := parse(in, out)
+	if err != nil {
+		return err
+	}
+	secondary := output.Statistics.Result.Custom.SecondaryValue
+	if secondary == nil {
+		return errors.New("output without secondary value")
+	}
+	weight := 0.0
+	for _, item := range solution.Items {
+		weight += item.Weight * float64(item.taken())
+	}
+	if math.Abs(*secondary-weight) > 1e-6 {
+		return fmt.Errorf("secondary value %v, want the weight %v", *secondary, weight)
+	}
+	return nil
+}
+
+func TestGoldenSynergies(t *testing.T) {
+	harness.FileTests(
+		t,
+		"synergies",
+		config(golden.Config{
+			// The soda is worth the most, but the chips and the salsa earn a
+			// larger bonus together than the chips and the soda.
+			DedicatedComparison: []string{
+				".statistics.result.value",
+				".solutions[0].synergies[0].a",
+				".solutions[0].synergies[0].b",
+			},
+			VerifyFunc: verifySynergies,
+		}),
+	)
+}
+
+// verifySynergies checks that exactly the synergies of which both items are
+// taken are reported.
+func verifySynergies(in, out []byte) error {
+	input, solution, _, err := parse(in, out)
+	if err != nil {
+		return err
+	}
+	taken := quantities(solution)
+	want := 0
+	for _, synergy := range input.Synergies {
+		if taken[synergy.A] > 0 && taken[synergy.B] > 0 {
+			want++
+		}
+	}
+	if len(solution.Synergies) != want {
+		return fmt.Errorf("%d synergies reported, want %d", len(solution.Synergies), want)
+	}
+	for _, synergy := range solution.Synergies {
+		if taken[synergy.A] == 0 || taken[synergy.B] == 0 {
+			return fmt.Errorf("synergy of %s and %s reported, but not both are taken", synergy.A, synergy.B)
+		}
+	}
+	return nil
+}
+
+// TestGoldenErrors checks that the app fails on the inputs that it rejects,
+// with the error written to stderr.
+func TestGoldenErrors(t *testing.T) {
+	c := config(golden.Config{})
+	c.ExitCode = 1
+	harness.FileTests(t, "errors", c)
+}
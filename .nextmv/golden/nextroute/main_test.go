@@ -1,47 +1,392 @@
 package mip
 
 import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"net/http/httptest"
 	"os"
+	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 
+	"apps-golden-file-tests/harness"
 	"github.com/nextmv-io/sdk/golden"
 )
 
+// outputSchema is the JSON schema that every output of the app must satisfy.
+// It is validated on top of the golden comparison, so that structural changes
+// are caught even if the golden files are updated.
+var outputSchema []byte
+
 func TestMain(m *testing.M) {
+	var err error
+	outputSchema, err = os.ReadFile("output.schema.json")
+	if err != nil {
+		log.Fatal(err)
+	}
 	code := m.Run()
 	os.Exit(code)
 }
 
 func TestGolden(t *testing.T) {
-	golden.FileTests(
+	// The app runs deterministically with these arguments, which is verified
+	// by running it twice.
+	harness.FileTests(
 		t,
 		"inputs",
-		golden.Config{
-			Args: []string{
-				"-solve.duration", "3s",
-				// for deterministic tests
-				"-format.disable.progression",
-				"-solve.parallelruns", "1",
-				"-solve.iterations", "50",
-				"-solve.rundeterministically",
-				"-solve.startsolutions", "1",
-			},
-			TransientFields: []golden.TransientField{
-				{Key: ".version.sdk", Replacement: golden.StableVersion},
-				{Key: ".version.nextroute", Replacement: golden.StableVersion},
-				{Key: ".statistics.result.duration", Replacement: golden.StableFloat},
-				{Key: ".statistics.run.duration", Replacement: golden.StableFloat},
-			},
-			Thresholds: golden.Tresholds{
-				Float: 0.01,
+		harness.Config{
+			RunTwice: true,
+			Config:   nextrouteConfig(),
+		},
+	)
+}
+
+// nextrouteConfig returns the configuration of the golden file tests that run
+// the app with a solve duration of 3s, deterministically, and the extra
+// arguments. The extra arguments are appended, so they may override the
+// others. Every output is validated against the output schema.
+func nextrouteConfig(extraArgs ...string) golden.Config {
+	args := []string{
+		"-solve.duration", "3s",
+		// for deterministic tests
+		"-format.disable.progression",
+		"-solve.parallelruns", "1",
+		"-solve.iterations", "50",
+		"-solve.rundeterministically",
+		"-solve.startsolutions", "1",
+	}
+
+	return harness.Baseline(golden.Config{
+		OutputSchema: outputSchema,
+		Args:         append(args, extraArgs...),
+		ExecutionConfig: &golden.ExecutionConfig{
+			Command:    "go",
+			Args:       []string{"run", "."},
+			InputFlag:  "-runner.input.path",
+			OutputFlag: "-runner.output.path",
+			WorkDir:    "../../../nextroute",
+		},
+	}, "nextroute")
+}
+
+// TestGoldenCrossings uses an input in which the target arrival times favor a
+// route that crosses itself. Penalizing crossings removes the crossing at a
+// small travel duration cost, which is reflected in the custom statistics.
+func TestGoldenCrossings(t *testing.T) {
+	harness.FileTests(t, "crossings", harness.Config{Config: nextrouteConfig("-crossings.penalty", "1000")})
+}
+
+// TestGoldenETABands uses an input in which the stops have a variable service
+// duration. The ETA bands widen with the variability accumulated down the
+// route.
+func TestGoldenETABands(t *testing.T) {
+	config := nextrouteConfig("-eta.bands")
+	config.VerifyFunc = verifyETABands
+	harness.FileTests(t, "eta-bands", harness.Config{Config: config})
+}
+
+// verifyETABands checks that the width of the ETA bands grows along every
+// route, as every stop of the input adds to the variability.
+func verifyETABands(_, output []byte) error {
+	var out struct {
+		Solutions []struct {
+			Vehicles []struct {
+				Route []struct {
+					Stop struct {
+						ID string `json:"id"`
+					} `json:"stop"`
+				} `json:"route"`
+			} `json:"vehicles"`
+		} `json:"solutions"`
+		Statistics struct {
+			Result struct {
+				Custom struct {
+					ETABands map[string]struct {
+						Low  time.Time `json:"low"`
+						High time.Time `json:"high"`
+					} `json:"eta_bands"`
+				} `json:"custom"`
+			} `json:"result"`
+		} `json:"statistics"`
+	}
+	if err := json.Unmarshal(output, &out); err != nil {
+		return err
+	}
+
+	bands := out.Statistics.Result.Custom.ETABands
+	for _, solution := range out.Solutions {
+		for _, vehicle := range solution.Vehicles {
+			previous := time.Duration(-1)
+			for _, stop := range vehicle.Route {
+				band, ok := bands[stop.Stop.ID]
+				if !ok {
+					continue
+				}
+				width := band.High.Sub(band.Low)
+				if width <= previous {
+					return fmt.Errorf("ETA band of stop %q: got width %v; want more than %v", stop.Stop.ID, width, previous)
+				}
+				previous = width
+			}
+		}
+	}
+
+	return nil
+}
+
+// TestGoldenCustomConstraints uses an input in which the custom constraints
+// change the routes: the hardware store is visited first, the dairy is reached
+// in time by the refrigerated vehicle and the butcher cannot be served by it
+// anymore. The check reports the refrigerated constraint for the butcher, but
+// the most binding reason is the end of the refrigerated vehicle.
+func TestGoldenCustomConstraints(t *testing.T) {
+	config := nextrouteConfig(
+		"-constraints.custom", "refrigerated,latest_arrival,first_stop",
+		"-check.duration", "1s",
+		"-check.verbosity", "medium",
+	)
+	config.TransientFields = append(config.TransientFields, golden.TransientField{
+		Key: ".solutions[0].check.duration_used", Replacement: golden.StableFloat,
+	})
+	harness.FileTests(t, "custom-constraints", harness.Config{Config: config})
+}
+
+// TestGoldenGeoJSON writes the routes of the solution as GeoJSON next to the
+// output, which is unchanged otherwise.
+func TestGoldenGeoJSON(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "routes.geojson")
+	config := nextrouteConfig("-geojson.path", path)
+	config.TransientFields = append(config.TransientFields, golden.TransientField{
+		Key: ".options.geojson.path", Replacement: golden.StableText,
+	})
+	config.VerifyFunc = func(_, output []byte) error {
+		return verifyGeoJSON(output, path)
+	}
+	harness.FileTests(t, "geojson", harness.Config{Config: config})
+}
+
+// verifyGeoJSON checks that the GeoJSON file at the given path holds a line
+// string per used vehicle and a point per stop of the output.
+func verifyGeoJSON(output []byte, path string) error {
+	var out struct {
+		Solutions []struct {
+			Vehicles []struct {
+				ID    string            `json:"id"`
+				Route []json.RawMessage `json:"route"`
+			} `json:"vehicles"`
+			Unplanned []json.RawMessage `json:"unplanned"`
+		} `json:"solutions"`
+	}
+	if err := json.Unmarshal(output, &out); err != nil {
+		return err
+	}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var collection struct {
+		Type     string `json:"type"`
+		Features []struct {
+			Geometry struct {
+				Type string `json:"type"`
+			} `json:"geometry"`
+		} `json:"features"`
+	}
+	if err := json.Unmarshal(b, &collection); err != nil {
+		return err
+	}
+
+	// The route of a vehicle includes its start and end.
+	routes, stops := 0, len(out.Solutions[0].Unplanned)
+	for _, vehicle := range out.Solutions[0].Vehicles {
+		if len(vehicle.Route) > 2 {
+			routes++
+			stops += len(vehicle.Route) - 2
+		}
+	}
+	geometries := map[string]int{}
+	for _, feature := range collection.Features {
+		geometries[feature.Geometry.Type]++
+	}
+	if collection.Type != "FeatureCollection" {
+		return fmt.Errorf("GeoJSON type: got %q; want %q", collection.Type, "FeatureCollection")
+	}
+	if geometries["LineString"] != routes {
+		return fmt.Errorf("GeoJSON line strings: got %d; want %d", geometries["LineString"], routes)
+	}
+	if geometries["Point"] != stops {
+		return fmt.Errorf("GeoJSON points: got %d; want %d", geometries["Point"], stops)
+	}
+
+	return nil
+}
+
+// TestGoldenOSRM fetches the travel durations and distances from a fake OSRM
+// server that measures Manhattan distances, as on a street grid.
+func TestGoldenOSRM(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(fakeOSRM))
+	t.Cleanup(server.Close)
+	config := nextrouteConfig("-osrm.url", server.URL)
+	config.TransientFields = append(config.TransientFields, golden.TransientField{
+		Key: ".options.osrm.url", Replacement: golden.StableText,
+	})
+	harness.FileTests(t, "osrm", harness.Config{Config: config})
+}
+
+// TestGoldenOSRMUnavailable uses an OSRM server that cannot be reached. The
+// haversine distances are used instead.
+func TestGoldenOSRMUnavailable(t *testing.T) {
+	config := nextrouteConfig("-osrm.url", "http://127.0.0.1:1")
+	config.TransientFields = append(config.TransientFields, golden.TransientField{
+		Key: ".options.osrm.url", Replacement: golden.StableText,
+	})
+	// The warning about the fallback to haversine distances is logged.
+	harness.FileTests(
+		t,
+		"osrm-unavailable",
+		harness.Config{
+			StderrGolden: true,
+			// The error of the failed request depends on the platform, e.g.
+			// connection refused or a timeout, so only the warning is kept.
+			StderrReplacements: []golden.VolatileRegexReplacement{
+				{Regex: `(using haversine distances): .*`, Replacement: "$1"},
 			},
-			ExecutionConfig: &golden.ExecutionConfig{
-				Command:    "go",
-				Args:       []string{"run", "."},
-				InputFlag:  "-runner.input.path",
-				OutputFlag: "-runner.output.path",
-				WorkDir:    "../../../nextroute",
+			Config: config,
+		},
+	)
+}
+
+// fakeOSRM serves the table service of OSRM. Durations and distances are the
+// Manhattan distances between the coordinates, traveled at 10 m/s.
+func fakeOSRM(w http.ResponseWriter, r *http.Request) {
+	segments := strings.Split(r.URL.Path, "/")
+	coordinates := strings.Split(segments[len(segments)-1], ";")
+	locations := make([][2]float64, len(coordinates))
+	for i, coordinate := range coordinates {
+		if _, err := fmt.Sscanf(coordinate, "%g,%g", &locations[i][0], &locations[i][1]); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	// One degree is about 100km.
+	durations := make([][]float64, len(locations))
+	distances := make([][]float64, len(locations))
+	for i, from := range locations {
+		durations[i] = make([]float64, len(locations))
+		distances[i] = make([]float64, len(locations))
+		for j, to := range locations {
+			distances[i][j] = (math.Abs(from[0]-to[0]) + math.Abs(from[1]-to[1])) * 100000
+			durations[i][j] = distances[i][j] / 10
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]any{
+		"code":      "Ok",
+		"durations": durations,
+		"distances": distances,
+	})
+}
+
+// TestGoldenDistanceMetric measures the distances between the stops, which lie
+// diagonally to each other, along a street grid and in a straight line. The
+// route along the street grid is longer than with the haversine distances of
+// the osrm-unavailable input.
+func TestGoldenDistanceMetric(t *testing.T) {
+	harness.FileTests(
+		t,
+		"distance-metric",
+		harness.Config{
+			ArgsMatrix: [][]string{
+				{"-distancemetric", "manhattan"},
+				{"-distancemetric", "euclidean"},
 			},
+			Config: nextrouteConfig(),
+		},
+	)
+}
+
+// TestGoldenLockedStops uses an input in which the stops around the depot are
+// best visited clockwise, but the bus is locked to visit c before a. The other
+// stops are planned around the locked ones.
+func TestGoldenLockedStops(t *testing.T) {
+	harness.FileTests(t, "locked-stops", harness.Config{Config: nextrouteConfig()})
+}
+
+// TestGoldenBalance uses an input in which a single vehicle serves all stops
+// at the lowest travel duration. Balancing the route durations splits the
+// stops between both vehicles, which is reflected in the custom statistics.
+func TestGoldenBalance(t *testing.T) {
+	harness.FileTests(t, "balance", harness.Config{Config: nextrouteConfig("-balance.weight", "1")})
+}
+
+// TestGoldenInitialSolution continues from a previous solution in which
+// vehicle-1 serves four of the five stops in a detour. Without iterations, the
+// output keeps these routes and only plans the remaining stop.
+func TestGoldenInitialSolution(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "output.json")
+	previous := `{"solutions": [{"vehicles": [
+		{"id": "vehicle-0", "route": [{"stop": {"id": "vehicle-0-start"}}, {"stop": {"id": "vehicle-0-end"}}]},
+		{"id": "vehicle-1", "route": [
+			{"stop": {"id": "vehicle-1-start"}},
+			{"stop": {"id": "s4"}},
+			{"stop": {"id": "s5"}},
+			{"stop": {"id": "s2"}},
+			{"stop": {"id": "s1"}},
+			{"stop": {"id": "vehicle-1-end"}}
+		]}
+	]}]}`
+	if err := os.WriteFile(path, []byte(previous), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	config := nextrouteConfig("-initialsolution.path", path, "-solve.iterations", "0")
+	config.TransientFields = append(config.TransientFields, golden.TransientField{
+		Key: ".options.initial_solution.path", Replacement: golden.StableText,
+	})
+	harness.FileTests(t, "initial-solution", harness.Config{Config: config})
+}
+
+// TestGoldenMustServe uses inputs in which the capacity of the vehicle does
+// not allow serving all stops. The far away stop is marked as must_serve and
+// is planned instead of a close one. If not all must-serve stops fit, the ones
+// that are not planned are reported in the custom statistics.
+func TestGoldenMustServe(t *testing.T) {
+	// Must-serve stops that are not planned are logged as a warning.
+	harness.FileTests(
+		t,
+		"must-serve",
+		harness.Config{
+			StderrGolden: true,
+			Config:       nextrouteConfig(),
 		},
 	)
 }
+
+// TestGoldenTraffic uses an input with rush hour traffic from 7:00 to 9:00,
+// during which travel takes twice as long. The vehicle departs to its first
+// stop before and to its second stop during rush hour.
+func TestGoldenTraffic(t *testing.T) {
+	harness.FileTests(t, "traffic", harness.Config{Config: nextrouteConfig()})
+}
+
+// TestGoldenBreaks uses inputs with a vehicle that must take a break of 15
+// minutes before driving more than 30 minutes. The breaks are reported in the
+// custom data of the route stops and shift their times. With a time window,
+// the vehicle serves the stop with the window before its first break. With a
+// maximum duration that only holds without the breaks, a stop is unplanned.
+func TestGoldenBreaks(t *testing.T) {
+	harness.FileTests(t, "breaks", harness.Config{Config: nextrouteConfig()})
+}
+
+// TestGoldenBackhaul uses an input with alternating deliveries and pickups
+// along a road. The vehicle serves all deliveries before all pickups, and its
+// capacity limits the outbound and the backhaul load separately, so it serves
+// more stops than its capacity.
+func TestGoldenBackhaul(t *testing.T) {
+	harness.FileTests(t, "backhaul", harness.Config{Config: nextrouteConfig()})
+}
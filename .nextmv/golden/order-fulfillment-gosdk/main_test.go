@@ -1,47 +1,916 @@
 package mip
 
 import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math"
 	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
 	"testing"
 
+	"apps-golden-file-tests/harness"
 	"github.com/nextmv-io/sdk/golden"
 )
 
+// outputSchema is the JSON schema that every output of the app must satisfy.
+// It is validated on top of the golden comparison, so that structural changes
+// are caught even if the golden files are updated.
+var outputSchema []byte
+
 func TestMain(m *testing.M) {
+	var err error
+	outputSchema, err = os.ReadFile("output.schema.json")
+	if err != nil {
+		log.Fatal(err)
+	}
 	code := m.Run()
 	os.Exit(code)
 }
 
 func TestGolden(t *testing.T) {
-	t.Skip("skipping until we have a path forward for go-mip and go-highs")
-	golden.FileTests(
+	harness.FileTests(
 		t,
 		"inputs",
-		golden.Config{
-			Args: []string{
-				"-solve.duration",
-				"3s",
-			},
-			TransientFields: []golden.TransientField{
-				{Key: ".version.sdk", Replacement: golden.StableVersion},
-				{Key: ".version.go-mip", Replacement: golden.StableVersion},
-				{Key: ".version.go-highs", Replacement: golden.StableVersion},
-				{Key: ".statistics.result.duration", Replacement: golden.StableFloat},
-				{Key: ".statistics.run.duration", Replacement: golden.StableFloat},
-			},
-			DedicatedComparison: []string{
-				".statistics.result.value",
-			},
-			Thresholds: golden.Tresholds{
-				Float: 0.01,
-			},
-			ExecutionConfig: &golden.ExecutionConfig{
-				Command:    "go",
-				Args:       []string{"run", "."},
-				InputFlag:  "-runner.input.path",
-				OutputFlag: "-runner.output.path",
-				WorkDir:    "../../../order-fulfillment-gosdk",
+		harness.Config{
+			// The objective must match closely, while the quantities derived
+			// from the fractional assignments may differ slightly between
+			// solutions of the same value.
+			Tolerances: []harness.Tolerance{
+				{Path: ".statistics.result.value", Tolerance: 0.001},
+				{Path: ".solutions[0].value", Tolerance: 0.001},
+				{Path: ".solutions[0].billable_weights", Tolerance: 0.1},
+				{Path: ".solutions[0].cartons", Tolerance: 0.1},
+				{Path: ".solutions[0].dimensional_weights", Tolerance: 0.1},
+				{Path: ".solutions[0].volumes", Tolerance: 0.1},
+				{Path: ".solutions[0].weights", Tolerance: 0.1},
 			},
+			Config: config(),
 		},
 	)
 }
+
+func TestGoldenPrecision(t *testing.T) {
+	// Rounding to whole numbers changes the values by more than the baseline
+	// threshold, e.g. the 2.3 cartons of distribution_center_2 and carrier1.
+	harness.FileTests(t, "precision", harness.Config{
+		Tolerances: []harness.Tolerance{
+			{Path: ".statistics.result.value", Tolerance: 0.001},
+			{Path: ".solutions[0].value", Tolerance: 0.001},
+		},
+		Config: config("-precision", "0"),
+	})
+}
+
+// config returns the configuration of the golden file tests that run the app
+// with a solve duration of 3s and the arguments. The arguments are appended,
+// so they may override the duration. Every output is validated against the
+// output schema.
+func config(args ...string) golden.Config {
+	return harness.Baseline(golden.Config{
+		OutputSchema: outputSchema,
+		Args:         append([]string{"-solve.duration", "3s"}, args...),
+		ExecutionConfig: &golden.ExecutionConfig{
+			Command:    "go",
+			Args:       []string{"run", "."},
+			InputFlag:  "-runner.input.path",
+			OutputFlag: "-runner.output.path",
+			WorkDir:    "../../../order-fulfillment-gosdk",
+		},
+	}, "go-mip", "go-highs")
+}
+
+// verifyConfig returns the configuration of a test that checks the output of
+// the app with the verification instead of comparing it against a golden
+// file.
+func verifyConfig(args []string, verify func(input, output []byte) error) harness.Config {
+	c := config(args...)
+	c.SkipGoldenComparison = true
+	c.VerifyFunc = verify
+
+	return harness.Config{Config: c}
+}
+
+// forEachSolution decodes every solution of the output into the type of the
+// parameter of check, which only declares the fields it needs, and checks it.
+// It returns the first error.
+func forEachSolution[S any](output []byte, check func(solution S) error) error {
+	var out struct {
+		Solutions []json.RawMessage `json:"solutions"`
+	}
+	if err := json.Unmarshal(output, &out); err != nil {
+		return err
+	}
+	for _, raw := range out.Solutions {
+		var solution S
+		if err := json.Unmarshal(raw, &solution); err != nil {
+			return err
+		}
+		if err := check(solution); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func TestGoldenItemsFilter(t *testing.T) {
+	filter := map[string]bool{"book": true, "mattress": true}
+	harness.FileTests(t, "items-filter", verifyConfig(
+		[]string{"-items.filter", "book,mattress"},
+		func(_, output []byte) error {
+			// Only the filtered items may be part of the assignments.
+			return forEachSolution(output, func(solution struct {
+				Assignments []struct {
+					ItemID string `json:"item_id"`
+				} `json:"assignments"`
+			}) error {
+				for _, a := range solution.Assignments {
+					if !filter[a.ItemID] {
+						return fmt.Errorf("item %q is not part of the filter", a.ItemID)
+					}
+				}
+				return nil
+			})
+		},
+	))
+}
+
+func TestGoldenRateSensitivity(t *testing.T) {
+	harness.FileTests(t, "rate-sensitivity", verifyConfig(
+		[]string{"-statistics.ratesensitivity"},
+		func(_, output []byte) error {
+			// carrier3 has no capacity and is therefore unused, while
+			// carrier1 ships most of the items from distribution_center_2.
+			var out struct {
+				Statistics struct {
+					Result struct {
+						Custom struct {
+							RateSensitivity map[string]float64 `json:"rate_sensitivity"`
+						} `json:"custom"`
+					} `json:"result"`
+				} `json:"statistics"`
+			}
+			if err := json.Unmarshal(output, &out); err != nil {
+				return err
+			}
+			sensitivity := out.Statistics.Result.Custom.RateSensitivity
+			for _, key := range []string{"distribution_center_1-carrier3", "distribution_center_2-carrier3"} {
+				if value, ok := sensitivity[key]; !ok || value != 0 {
+					return fmt.Errorf("rate sensitivity of unused %s: got %v; want 0", key, value)
+				}
+			}
+			if value := sensitivity["distribution_center_2-carrier1"]; value <= 0 {
+				return fmt.Errorf("rate sensitivity of distribution_center_2-carrier1: got %v; want > 0", value)
+			}
+			return nil
+		},
+	))
+}
+
+func TestBuildTimeout(t *testing.T) {
+	// Blow up the sample input with many items that are in stock at every
+	// distribution center, so that computing the assignments alone exceeds the
+	// build timeout.
+	data, err := os.ReadFile(filepath.Join("inputs", "input.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var in map[string]any
+	if err := json.Unmarshal(data, &in); err != nil {
+		t.Fatal(err)
+	}
+	items := make([]map[string]any, 50000)
+	inventory := make(map[string]any, len(items))
+	for i := range items {
+		id := fmt.Sprintf("item-%d", i)
+		items[i] = map[string]any{
+			"item_id":     id,
+			"quantity":    1,
+			"unit_volume": 0.1,
+			"unit_weight": 0.1,
+		}
+		inventory[id] = 1
+	}
+	in["items"] = items
+	for _, dc := range in["distribution_centers"].([]any) {
+		dc.(map[string]any)["inventory"] = inventory
+	}
+	data, err = json.Marshal(in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "input.json")
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	cmd := exec.Command("go", "run", ".", "-runner.input.path", path, "-build.timeout", "1ms")
+	cmd.Dir = "../../../order-fulfillment-gosdk"
+	output, err := cmd.CombinedOutput()
+	if err == nil {
+		t.Fatalf("expected the build to be aborted, got output: %s", output)
+	}
+	for _, want := range []string{"build timeout of 1ms exceeded", "of 50000 items processed", "assignments created"} {
+		if !strings.Contains(string(output), want) {
+			t.Errorf("output does not contain %q: %s", want, output)
+		}
+	}
+}
+
+func TestGoldenDCUsage(t *testing.T) {
+	harness.FileTests(t, "dc-usage", verifyConfig(
+		[]string{"-dcusagepenalty", "100"},
+		func(_, output []byte) error {
+			// distribution_center_2 has all items in stock, so the order is
+			// consolidated into it although splitting it is slightly cheaper.
+			var out struct {
+				Statistics struct {
+					Result struct {
+						Custom struct {
+							ActiveDistributionCenters int `json:"active_distribution_centers"`
+						} `json:"custom"`
+					} `json:"result"`
+				} `json:"statistics"`
+			}
+			if err := json.Unmarshal(output, &out); err != nil {
+				return err
+			}
+			if active := out.Statistics.Result.Custom.ActiveDistributionCenters; active != 1 {
+				return fmt.Errorf("active distribution centers: got %d; want 1", active)
+			}
+			return nil
+		},
+	))
+}
+
+func TestGoldenHandlingCapacity(t *testing.T) {
+	harness.FileTests(t, "handling-capacity", verifyConfig(
+		nil,
+		func(_, output []byte) error {
+			// Without a handling capacity, distribution_center_2 handles
+			// more than 4 cartons. The capacity of 3 shifts some of them to
+			// distribution_center_1.
+			return forEachSolution(output, func(solution struct {
+				Cartons     map[string]float64 `json:"cartons"`
+				Utilization map[string]float64 `json:"utilization"`
+			}) error {
+				if solution.Cartons == nil {
+					return errors.New("solution without cartons")
+				}
+				cartons := solution.Cartons["distribution_center_2-carrier1"] +
+					solution.Cartons["distribution_center_2-carrier2"]
+				if cartons > 3+1e-6 {
+					return fmt.Errorf("cartons at distribution_center_2: got %v; want at most 3", cartons)
+				}
+				if utilization, ok := solution.Utilization["distribution_center_2"]; !ok || utilization > 1 {
+					return fmt.Errorf("utilization of distribution_center_2: got %v; want at most 1", utilization)
+				}
+				if _, ok := solution.Utilization["distribution_center_1"]; ok {
+					return errors.New("uncapacitated distribution_center_1 must not report a utilization")
+				}
+				return nil
+			})
+		},
+	))
+}
+
+func TestGoldenAllocationPlan(t *testing.T) {
+	harness.FileTests(t, "allocation-plan", verifyConfig(
+		[]string{"-format.allocationplan"},
+		verifyAllocationPlan,
+	))
+}
+
+// verifyAllocationPlan checks that the nested allocation plan reconciles with
+// the flat list of assignments and the reported total costs.
+func verifyAllocationPlan(_, output []byte) error {
+	type group struct {
+		DeliveryCosts float64 `json:"delivery_costs"`
+		HandlingCosts float64 `json:"handling_costs"`
+	}
+	var out struct {
+		Statistics struct {
+			Result struct {
+				Custom group `json:"custom"`
+			} `json:"result"`
+		} `json:"statistics"`
+	}
+	if err := json.Unmarshal(output, &out); err != nil {
+		return err
+	}
+
+	const tolerance = 0.02
+	return forEachSolution(output, func(solution struct {
+		Assignments []struct {
+			ItemID               string `json:"item_id"`
+			Quantity             int    `json:"quantity"`
+			DistributionCenterID string `json:"distribution_center_id"`
+			CarrierID            string `json:"carrier_id"`
+		} `json:"assignments"`
+		AllocationPlan []struct {
+			group
+			CarrierID           string `json:"carrier_id"`
+			DistributionCenters []struct {
+				group
+				DistributionCenterID string `json:"distribution_center_id"`
+				Items                []struct {
+					ItemID   string `json:"item_id"`
+					Quantity int    `json:"quantity"`
+				} `json:"items"`
+			} `json:"distribution_centers"`
+		} `json:"allocation_plan"`
+	}) error {
+		if solution.AllocationPlan == nil {
+			return errors.New("solution without allocation_plan")
+		}
+
+		quantities := map[string]int{}
+		for _, a := range solution.Assignments {
+			quantities[a.CarrierID+"/"+a.DistributionCenterID+"/"+a.ItemID] += a.Quantity
+		}
+
+		var total group
+		for _, c := range solution.AllocationPlan {
+			var subtotal group
+			for _, dc := range c.DistributionCenters {
+				subtotal.DeliveryCosts += dc.DeliveryCosts
+				subtotal.HandlingCosts += dc.HandlingCosts
+				for _, it := range dc.Items {
+					key := c.CarrierID + "/" + dc.DistributionCenterID + "/" + it.ItemID
+					if quantities[key] != it.Quantity {
+						return fmt.Errorf("quantity of %s: got %d; want %d", key, it.Quantity, quantities[key])
+					}
+					delete(quantities, key)
+				}
+			}
+			if math.Abs(subtotal.DeliveryCosts-c.DeliveryCosts) > tolerance ||
+				math.Abs(subtotal.HandlingCosts-c.HandlingCosts) > tolerance {
+				return fmt.Errorf("costs of %s: got %+v; want %+v", c.CarrierID, c.group, subtotal)
+			}
+			total.DeliveryCosts += c.DeliveryCosts
+			total.HandlingCosts += c.HandlingCosts
+		}
+		if len(quantities) > 0 {
+			return fmt.Errorf("assignments missing in the allocation plan: %v", quantities)
+		}
+		custom := out.Statistics.Result.Custom
+		if math.Abs(total.DeliveryCosts-custom.DeliveryCosts) > tolerance ||
+			math.Abs(total.HandlingCosts-custom.HandlingCosts) > tolerance {
+			return fmt.Errorf("total costs: got %+v; want %+v", total, custom)
+		}
+		return nil
+	})
+}
+
+func TestGoldenCarrierFixedCosts(t *testing.T) {
+	harness.FileTests(t, "carrier-fixed-costs", verifyConfig(
+		nil,
+		func(_, output []byte) error {
+			// Without fixed costs, all four distribution center carrier
+			// combinations ship items. A pickup fee of 5 per combination
+			// consolidates the shipments onto two of them.
+			var out struct {
+				Statistics struct {
+					Result struct {
+						Custom struct {
+							FixedCosts float64 `json:"fixed_costs"`
+						} `json:"custom"`
+					} `json:"result"`
+				} `json:"statistics"`
+			}
+			if err := json.Unmarshal(output, &out); err != nil {
+				return err
+			}
+			err := forEachSolution(output, func(solution struct {
+				ActiveCarriers map[string]float64 `json:"active_carriers"`
+			}) error {
+				if solution.ActiveCarriers == nil {
+					return errors.New("solution without active_carriers")
+				}
+				if len(solution.ActiveCarriers) != 2 {
+					return fmt.Errorf("active carriers: got %v; want 2 of them", solution.ActiveCarriers)
+				}
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+			if fixedCosts := out.Statistics.Result.Custom.FixedCosts; fixedCosts != 10 {
+				return fmt.Errorf("fixed costs: got %v; want 10", fixedCosts)
+			}
+			return nil
+		},
+	))
+}
+
+func TestGoldenFractionalQuantities(t *testing.T) {
+	harness.FileTests(t, "fractional-quantities", verifyConfig(
+		nil,
+		func(_, output []byte) error {
+			// 2.5 units of coffee are ordered while neither distribution
+			// center has enough in stock, so the quantity is split in
+			// fractions between them.
+			return forEachSolution(output, func(solution struct {
+				Assignments []struct {
+					ItemID               string  `json:"item_id"`
+					Quantity             float64 `json:"quantity"`
+					DistributionCenterID string  `json:"distribution_center_id"`
+				} `json:"assignments"`
+				Unfulfilled []json.RawMessage `json:"unfulfilled"`
+			}) error {
+				if solution.Assignments == nil {
+					return errors.New("solution without assignments")
+				}
+				if len(solution.Unfulfilled) > 0 {
+					return fmt.Errorf("unfulfilled items: got %d; want none", len(solution.Unfulfilled))
+				}
+				shipped := map[string]float64{}
+				total := 0.0
+				for _, a := range solution.Assignments {
+					if a.ItemID == "coffee" {
+						shipped[a.DistributionCenterID] += a.Quantity
+						total += a.Quantity
+					}
+				}
+				if math.Abs(total-2.5) > 0.02 {
+					return fmt.Errorf("shipped coffee: got %v; want 2.5", total)
+				}
+				inventory := map[string]float64{"distribution_center_1": 1.2, "distribution_center_2": 1.8}
+				for dc, quantity := range shipped {
+					if quantity > inventory[dc]+0.02 {
+						return fmt.Errorf("shipped coffee from %s: got %v; want at most %v", dc, quantity, inventory[dc])
+					}
+				}
+				return nil
+			})
+		},
+	))
+}
+
+func TestGoldenEmissions(t *testing.T) {
+	harness.FileTests(t, "emissions", verifyConfig(
+		[]string{"-emissionweight", "1"},
+		func(_, output []byte) error {
+			// distribution_center_1 emits a fifth of distribution_center_2.
+			// Without weighing the emissions, most items are shipped from
+			// distribution_center_2, which emits more than 10 kg of CO2.
+			var out struct {
+				Statistics struct {
+					Result struct {
+						Custom struct {
+							Emissions float64 `json:"emissions"`
+						} `json:"custom"`
+					} `json:"result"`
+				} `json:"statistics"`
+			}
+			if err := json.Unmarshal(output, &out); err != nil {
+				return err
+			}
+			if emissions := out.Statistics.Result.Custom.Emissions; emissions <= 0 || emissions >= 10 {
+				return fmt.Errorf("emissions: got %v; want between 0 and 10", emissions)
+			}
+			return nil
+		},
+	))
+}
+
+func TestGoldenPreferredDC(t *testing.T) {
+	harness.FileTests(t, "preferred-dc", verifyConfig(
+		[]string{"-preferencebonus", "0.5"},
+		func(_, output []byte) error {
+			// Without the bonus, one of the two sneakers is shipped from
+			// distribution_center_2 at the same cost.
+			var out struct {
+				Statistics struct {
+					Result struct {
+						Custom struct {
+							Honored    float64 `json:"preferred_units_honored"`
+							NotHonored float64 `json:"preferred_units_not_honored"`
+						} `json:"custom"`
+					} `json:"result"`
+				} `json:"statistics"`
+			}
+			if err := json.Unmarshal(output, &out); err != nil {
+				return err
+			}
+			custom := out.Statistics.Result.Custom
+			if custom.Honored != 2 || custom.NotHonored != 0 {
+				return fmt.Errorf(
+					"preferred units: got %v honored, %v not honored; want 2, 0",
+					custom.Honored, custom.NotHonored,
+				)
+			}
+			return nil
+		},
+	))
+}
+
+func TestGoldenCarrierWeightCapacities(t *testing.T) {
+	harness.FileTests(t, "carrier-weight-capacities", verifyConfig(
+		nil,
+		func(_, output []byte) error {
+			// Without weight capacities, both carriers pick up about 10 kg
+			// at distribution_center_2. The capacity of 8 kg shifts some
+			// items to distribution_center_1.
+			return forEachSolution(output, func(solution struct {
+				Weights map[string]float64 `json:"weights"`
+			}) error {
+				if solution.Weights == nil {
+					return errors.New("solution without weights")
+				}
+				for _, id := range []string{"distribution_center_2-carrier1", "distribution_center_2-carrier2"} {
+					if weight := solution.Weights[id]; weight > 8+1e-6 {
+						return fmt.Errorf("weight of %s: got %v; want at most 8", id, weight)
+					}
+				}
+				return nil
+			})
+		},
+	))
+}
+
+func TestGoldenGap(t *testing.T) {
+	harness.FileTests(t, "gap", verifyConfig(
+		[]string{"-solve.duration", "10s", "-solve.mip.gap.relative", "0.01"},
+		func(_, output []byte) error {
+			var out struct {
+				Statistics struct {
+					Run struct {
+						Custom struct {
+							Gap *float64 `json:"gap"`
+						} `json:"custom"`
+					} `json:"run"`
+				} `json:"statistics"`
+			}
+			if err := json.Unmarshal(output, &out); err != nil {
+				return err
+			}
+			if gap := out.Statistics.Run.Custom.Gap; gap == nil || *gap != 0.01 {
+				return fmt.Errorf("gap: got %v; want 0.01", gap)
+			}
+			return nil
+		},
+	))
+}
+
+func TestGoldenExportModel(t *testing.T) {
+	for _, format := range []string{"lp", "mps"} {
+		t.Run(format, func(t *testing.T) {
+			// The directory holds a single input, so the exported model is
+			// compared against the golden file of that input.
+			path := filepath.Join(t.TempDir(), "model."+format)
+			harness.FileTests(t, "export-model", verifyConfig(
+				[]string{"-exportmodelpath", path},
+				func(_, _ []byte) error {
+					model, err := os.ReadFile(path)
+					if err != nil {
+						return err
+					}
+					return harness.CompareFile(model, filepath.Join("export-model", "input."+format+".golden"))
+				},
+			))
+		})
+	}
+}
+
+func TestGoldenHandlingTiers(t *testing.T) {
+	harness.FileTests(t, "handling-tiers", verifyConfig(
+		nil,
+		func(_, output []byte) error {
+			// Beyond 3 cartons, distribution_center_1 handles cartons at a
+			// rate of 0.1, which makes it cheaper than
+			// distribution_center_2.
+			return forEachSolution(output, func(solution struct {
+				Cartons       map[string]float64 `json:"cartons"`
+				HandlingTiers map[string]int     `json:"handling_tiers"`
+			}) error {
+				if solution.Cartons == nil {
+					return errors.New("solution without cartons")
+				}
+				cartons := solution.Cartons["distribution_center_1-carrier1"] +
+					solution.Cartons["distribution_center_1-carrier2"]
+				if cartons <= 3 {
+					return fmt.Errorf("cartons at distribution_center_1: got %v; want more than 3", cartons)
+				}
+				if tier, ok := solution.HandlingTiers["distribution_center_1"]; !ok || tier != 2 {
+					return fmt.Errorf("handling tier of distribution_center_1: got %v; want 2", tier)
+				}
+				if _, ok := solution.HandlingTiers["distribution_center_2"]; ok {
+					return errors.New("distribution_center_2 without handling tiers must not report a tier")
+				}
+				return nil
+			})
+		},
+	))
+}
+
+func TestGoldenPriority(t *testing.T) {
+	harness.FileTests(t, "priority", verifyConfig(
+		nil,
+		func(_, output []byte) error {
+			// The carrier capacity fits either all books or a mattress and
+			// two books. Without its priority of 10, the mattress would be
+			// left unfulfilled to ship more units.
+			return forEachSolution(output, func(solution struct {
+				Unfulfilled []struct {
+					ItemID   string  `json:"item_id"`
+					Quantity float64 `json:"quantity"`
+					Priority int     `json:"priority"`
+				} `json:"unfulfilled"`
+			}) error {
+				if solution.Unfulfilled == nil {
+					return errors.New("solution without unfulfilled")
+				}
+				want := map[string]struct {
+					quantity float64
+					priority int
+				}{
+					"book":     {3, 1},
+					"mattress": {1, 10},
+				}
+				if len(solution.Unfulfilled) != len(want) {
+					return fmt.Errorf("unfulfilled: got %v; want %v", solution.Unfulfilled, want)
+				}
+				for _, u := range solution.Unfulfilled {
+					if w, ok := want[u.ItemID]; !ok || w.quantity != u.Quantity || w.priority != u.Priority {
+						return fmt.Errorf("unfulfilled: got %v; want %v", solution.Unfulfilled, want)
+					}
+				}
+				return nil
+			})
+		},
+	))
+}
+
+func TestGoldenCarrierMaxCartons(t *testing.T) {
+	harness.FileTests(t, "carrier-max-cartons", verifyConfig(
+		nil,
+		func(_, output []byte) error {
+			// Without caps, carrier1 ships 2.3 cartons from
+			// distribution_center_2. Both carriers there accept at most 2
+			// cartons and the caps reached must be reported.
+			var out struct {
+				Statistics struct {
+					Result struct {
+						Custom struct {
+							BindingCartonCaps []string `json:"binding_carton_caps"`
+						} `json:"custom"`
+					} `json:"result"`
+				} `json:"statistics"`
+			}
+			if err := json.Unmarshal(output, &out); err != nil {
+				return err
+			}
+			return forEachSolution(output, func(solution struct {
+				Cartons map[string]float64 `json:"cartons"`
+			}) error {
+				if solution.Cartons == nil {
+					return errors.New("solution without cartons")
+				}
+				want := []string{}
+				for _, id := range []string{"distribution_center_2-carrier1", "distribution_center_2-carrier2"} {
+					cartons := solution.Cartons[id]
+					if cartons > 2+1e-6 {
+						return fmt.Errorf("cartons of %s: got %v; want at most 2", id, cartons)
+					}
+					if cartons > 2-1e-6 {
+						want = append(want, id)
+					}
+				}
+				if got := out.Statistics.Result.Custom.BindingCartonCaps; fmt.Sprint(got) != fmt.Sprint(want) {
+					return fmt.Errorf("binding carton caps: got %v; want %v", got, want)
+				}
+				return nil
+			})
+		},
+	))
+}
+
+func TestGoldenSplitPenalty(t *testing.T) {
+	harness.FileTests(t, "split-penalty", verifyConfig(
+		[]string{"-splitpenalty", "10"},
+		func(_, output []byte) error {
+			// distribution_center_2 handles cartons cheaper, but its carrier
+			// only takes part of the books. Without the penalty, the books
+			// are split between both distribution centers.
+			return forEachSolution(output, func(solution struct {
+				Assignments []struct {
+					Quantity             float64 `json:"quantity"`
+					DistributionCenterID string  `json:"distribution_center_id"`
+				} `json:"assignments"`
+			}) error {
+				shipped := map[string]float64{}
+				for _, a := range solution.Assignments {
+					shipped[a.DistributionCenterID] += a.Quantity
+				}
+				if len(shipped) != 1 || shipped["distribution_center_1"] != 10 {
+					return fmt.Errorf("shipped books: got %v; want 10 from distribution_center_1", shipped)
+				}
+				return nil
+			})
+		},
+	))
+}
+
+func TestGoldenCartonVolume(t *testing.T) {
+	harness.FileTests(t, "carton-volume", verifyConfig(
+		nil,
+		func(_, output []byte) error {
+			// The books fill 4 cartons of their own volume of 0.5 instead of
+			// a single one of the global volume of 2. The sneakers fill half
+			// a carton of the global volume.
+			return forEachSolution(output, func(solution struct {
+				Cartons map[string]float64 `json:"cartons"`
+			}) error {
+				if cartons := solution.Cartons["distribution_center_1-carrier1"]; cartons != 4.5 {
+					return fmt.Errorf("cartons: got %v; want 4.5", cartons)
+				}
+				return nil
+			})
+		},
+	))
+}
+
+func TestGoldenTransitDays(t *testing.T) {
+	harness.FileTests(t, "transit-days", verifyConfig(
+		nil,
+		func(_, output []byte) error {
+			// distribution_center_2 handles cartons cheaper, but its carrier
+			// takes 3 days, while the books must arrive within 2 days.
+			return forEachSolution(output, func(solution struct {
+				Assignments []struct {
+					Quantity             float64 `json:"quantity"`
+					DistributionCenterID string  `json:"distribution_center_id"`
+				} `json:"assignments"`
+			}) error {
+				shipped := map[string]float64{}
+				for _, a := range solution.Assignments {
+					shipped[a.DistributionCenterID] += a.Quantity
+				}
+				if len(shipped) != 1 || shipped["distribution_center_1"] != 5 {
+					return fmt.Errorf("shipped books: got %v; want 5 from distribution_center_1", shipped)
+				}
+				return nil
+			})
+		},
+	))
+}
+
+func TestGoldenWeights(t *testing.T) {
+	// distribution_center_1 delivers the mattress cheaper, distribution_center_2
+	// handles its cartons cheaper. With the default weights, the delivery
+	// costs decide, weighing the handling costs 10 times flips the DC.
+	tests := []struct {
+		name string
+		args []string
+		dc   string
+	}{
+		{name: "default", dc: "distribution_center_1"},
+		{name: "handling", args: []string{"-weights.handling", "10"}, dc: "distribution_center_2"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			harness.FileTests(t, "weights", verifyConfig(
+				test.args,
+				func(_, output []byte) error {
+					return forEachSolution(output, func(solution struct {
+						Assignments []struct {
+							DistributionCenterID string `json:"distribution_center_id"`
+						} `json:"assignments"`
+					}) error {
+						if len(solution.Assignments) != 1 || solution.Assignments[0].DistributionCenterID != test.dc {
+							return fmt.Errorf("assignments: got %+v; want the mattress from %s", solution.Assignments, test.dc)
+						}
+						return nil
+					})
+				},
+			))
+		})
+	}
+}
+
+// TestGoldenCSV checks the cost breakdown that the app writes to a CSV next to
+// its output.
+func TestGoldenCSV(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "costs.csv")
+	harness.FileTests(t, "csv", verifyConfig(
+		[]string{"-csvpath", path},
+		func(_, output []byte) error {
+			return verifyCSV(output, path)
+		},
+	))
+}
+
+// verifyCSV checks that the CSV file at the given path has the header of the
+// cost breakdown and a row per distribution center and carrier of the output,
+// sorted by both, with the cartons of the output.
+func verifyCSV(output []byte, path string) error {
+	var out struct {
+		Solutions []struct {
+			Cartons map[string]float64 `json:"cartons"`
+		} `json:"solutions"`
+	}
+	if err := json.Unmarshal(output, &out); err != nil {
+		return err
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	records, err := csv.NewReader(f).ReadAll()
+	if err != nil {
+		return err
+	}
+
+	header := []string{
+		"distribution_center_id", "carrier_id", "cartons", "volume",
+		"weight", "billable_weight", "weight_tier", "delivery_cost",
+	}
+	if len(records) == 0 {
+		return errors.New("csv without header")
+	}
+	if !slices.Equal(records[0], header) {
+		return fmt.Errorf("csv header: got %v; want %v", records[0], header)
+	}
+	cartons := out.Solutions[0].Cartons
+	keys := make([]string, 0, len(cartons))
+	for key := range cartons {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+	rows := records[1:]
+	if len(rows) != len(keys) {
+		return fmt.Errorf("csv rows: got %d; want one per distribution center and carrier, %d", len(rows), len(keys))
+	}
+	for i, row := range rows {
+		if key := row[0] + "-" + row[1]; key != keys[i] {
+			return fmt.Errorf("csv row %d: got %s; want %s", i+1, key, keys[i])
+		}
+		if value, err := strconv.ParseFloat(row[2], 64); err != nil || value != cartons[keys[i]] {
+			return fmt.Errorf("csv cartons of %s: got %s; want %v", keys[i], row[2], cartons[keys[i]])
+		}
+	}
+
+	return nil
+}
+
+// TestGoldenInvalidInput uses an input in which the book is ordered with a
+// quantity of 0. The app must reject it with a nonzero exit code.
+func TestGoldenInvalidInput(t *testing.T) {
+	c := config()
+	c.ExitCode = 1
+	harness.FileTests(
+		t,
+		"invalid-input",
+		harness.Config{Config: c},
+	)
+}
+
+func TestInvalidInput(t *testing.T) {
+	// Break the referential integrity of the sample input in several ways.
+	data, err := os.ReadFile(filepath.Join("inputs", "input.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var in map[string]any
+	if err := json.Unmarshal(data, &in); err != nil {
+		t.Fatal(err)
+	}
+	in["items"].([]any)[0].(map[string]any)["quantity"] = 0
+	costs := in["carrier_delivery_costs"].(map[string]any)
+	delete(costs["distribution_center_2"].(map[string]any), "carrier1")
+	carrier2 := costs["distribution_center_1"].(map[string]any)["carrier2"].(map[string]any)
+	carrier2["weight_rates"] = carrier2["weight_rates"].([]any)[1:]
+	data, err = json.Marshal(in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "input.json")
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	cmd := exec.Command("go", "run", ".", "-runner.input.path", path)
+	cmd.Dir = "../../../order-fulfillment-gosdk"
+	output, err := cmd.CombinedOutput()
+	if err == nil {
+		t.Fatalf("expected the input to be rejected, got output: %s", output)
+	}
+	for _, want := range []string{
+		`item "book": quantity must be positive`,
+		`distribution center "distribution_center_2", carrier "carrier1": missing delivery costs`,
+		`distribution center "distribution_center_1", carrier "carrier2": 15 weight_tiers but 14 weight_rates`,
+	} {
+		if !strings.Contains(string(output), want) {
+			t.Errorf("output does not contain %q: %s", want, output)
+		}
+	}
+}
@@ -1,46 +1,961 @@
 package mip
 
 import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math"
 	"os"
+	"path/filepath"
 	"testing"
+	"time"
 
+	"apps-golden-file-tests/harness"
 	"github.com/nextmv-io/sdk/golden"
 )
 
+// outputSchema is the JSON schema that every output of the app must satisfy.
+// It is validated on top of the golden comparison, so that structural changes
+// are caught even if the golden files are updated.
+var outputSchema []byte
+
 func TestMain(m *testing.M) {
+	var err error
+	outputSchema, err = os.ReadFile("output.schema.json")
+	if err != nil {
+		log.Fatal(err)
+	}
 	code := m.Run()
 	os.Exit(code)
 }
 
 func TestGolden(t *testing.T) {
-	t.Skip("skipping until we have a path forward for go-mip and go-highs")
-	golden.FileTests(
+	harness.FileTests(
 		t,
 		"inputs",
-		golden.Config{
+		config(golden.Config{
+			DedicatedComparison: []string{
+				".statistics.result.value",
+			},
+		}),
+	)
+}
+
+// config completes the test specific configuration with the settings shared
+// by all tests: the app is run with a solve duration of 3s ahead of the given
+// arguments, so they may override it, and every output is validated against
+// the output schema.
+func config(c golden.Config) harness.Config {
+	c.OutputSchema = outputSchema
+	c.Args = append([]string{"-solve.duration", "3s"}, c.Args...)
+	c.ExecutionConfig = &golden.ExecutionConfig{
+		Command:    "go",
+		Args:       []string{"run", "."},
+		InputFlag:  "-runner.input.path",
+		OutputFlag: "-runner.output.path",
+		WorkDir:    "../../../shift-scheduling-gosdk",
+	}
+	return harness.Config{Config: harness.Baseline(c, "go-mip", "go-highs")}
+}
+
+func TestGoldenAssignments(t *testing.T) {
+	harness.FileTests(
+		t,
+		"assignments",
+		config(golden.Config{
 			Args: []string{
-				"-solve.duration", "3s",
+				"-format.assignments",
 			},
-			TransientFields: []golden.TransientField{
-				{Key: ".version.sdk", Replacement: golden.StableVersion},
-				{Key: ".version.go-mip", Replacement: golden.StableVersion},
-				{Key: ".version.go-highs", Replacement: golden.StableVersion},
-				{Key: ".statistics.result.duration", Replacement: golden.StableFloat},
-				{Key: ".statistics.run.duration", Replacement: golden.StableFloat},
+			DedicatedComparison: []string{
+				".solutions[0].status",
+				".solutions[0].value",
+				".statistics.result.value",
+				".statistics.result.custom.coverage",
+				".statistics.result.custom.over_supply_penalty",
+				".statistics.result.custom.under_supply_penalty",
 			},
+		}),
+	)
+}
+
+func TestGoldenShiftTemplates(t *testing.T) {
+	harness.FileTests(
+		t,
+		"shift-templates",
+		config(golden.Config{
 			DedicatedComparison: []string{
 				".statistics.result.value",
 			},
-			Thresholds: golden.Tresholds{
-				Float: 0.01,
+			VerifyFunc: verifyShiftTemplates,
+		}),
+	)
+}
+
+// verifyShiftTemplates checks that every assigned shift stems from a template
+// and that the model is smaller than the one of the enumerated shifts of the
+// same workers and demands.
+func verifyShiftTemplates(_, output []byte) error {
+	type result struct {
+		Solutions []struct {
+			AssignedShifts []struct {
+				ShiftTemplateID string `json:"shift_template_id"`
+			} `json:"assigned_shifts"`
+		} `json:"solutions"`
+		Statistics struct {
+			Result struct {
+				Custom struct {
+					Variables int `json:"variables"`
+				} `json:"custom"`
+			} `json:"result"`
+		} `json:"statistics"`
+	}
+
+	var templates result
+	if err := json.Unmarshal(output, &templates); err != nil {
+		return err
+	}
+	for _, solution := range templates.Solutions {
+		for _, shift := range solution.AssignedShifts {
+			if shift.ShiftTemplateID == "" {
+				return errors.New("assigned shift without a shift template")
+			}
+		}
+	}
+
+	data, err := os.ReadFile(filepath.Join("inputs", "input.json.golden"))
+	if err != nil {
+		return err
+	}
+	var enumerated result
+	if err := json.Unmarshal(data, &enumerated); err != nil {
+		return err
+	}
+	got := templates.Statistics.Result.Custom.Variables
+	want := enumerated.Statistics.Result.Custom.Variables
+	if got >= want {
+		return fmt.Errorf("variables of the templates model: got %d; want less than %d", got, want)
+	}
+
+	return nil
+}
+
+func TestGoldenMaxContinuous(t *testing.T) {
+	harness.FileTests(
+		t,
+		"max-continuous",
+		config(golden.Config{
+			Args: []string{
+				"-format.assignments",
+				"-limits.shift.maxcontinuous", "6h",
+			},
+			DedicatedComparison: []string{
+				".solutions[0].status",
+				".solutions[0].value",
+				".statistics.result.custom.coverage",
+			},
+			VerifyFunc: verifyMaxContinuous,
+		}),
+	)
+}
+
+// verifyMaxContinuous checks that the 8 hour demand is covered by two workers
+// whose shifts are at most 6 hours long.
+func verifyMaxContinuous(_, output []byte) error {
+	var out struct {
+		Solutions []struct {
+			Assignments []struct {
+				Start    time.Time `json:"start"`
+				End      time.Time `json:"end"`
+				WorkerID string    `json:"worker_id"`
+			} `json:"assignments"`
+		} `json:"solutions"`
+	}
+	if err := json.Unmarshal(output, &out); err != nil {
+		return err
+	}
+	for _, solution := range out.Solutions {
+		workers := map[string]bool{}
+		for _, assignment := range solution.Assignments {
+			if duration := assignment.End.Sub(assignment.Start); duration > 6*time.Hour {
+				return fmt.Errorf("shift of %s: got %v; want at most 6h", assignment.WorkerID, duration)
+			}
+			workers[assignment.WorkerID] = true
+		}
+		if len(workers) != 2 {
+			return fmt.Errorf("workers: got %d; want 2", len(workers))
+		}
+	}
+
+	return nil
+}
+
+func TestGoldenSkills(t *testing.T) {
+	harness.FileTests(
+		t,
+		"skills",
+		config(golden.Config{
+			Args: []string{
+				"-format.assignments",
+			},
+			DedicatedComparison: []string{
+				".solutions[0].status",
+				".solutions[0].value",
+				".statistics.result.custom.coverage",
+			},
+			VerifyFunc: verifySkills,
+		}),
+	)
+}
+
+// verifySkills checks that the barista demand from 08:00 to 12:00 is only
+// covered by the barista.
+func verifySkills(_, output []byte) error {
+	var out struct {
+		Solutions []struct {
+			Assignments []struct {
+				Start    time.Time `json:"start"`
+				End      time.Time `json:"end"`
+				WorkerID string    `json:"worker_id"`
+			} `json:"assignments"`
+		} `json:"solutions"`
+	}
+	if err := json.Unmarshal(output, &out); err != nil {
+		return err
+	}
+	start := time.Date(2023, 12, 10, 13, 0, 0, 0, time.UTC)
+	end := time.Date(2023, 12, 10, 17, 0, 0, 0, time.UTC)
+	for _, solution := range out.Solutions {
+		covered := false
+		for _, assignment := range solution.Assignments {
+			if assignment.Start.After(start) || assignment.End.Before(end) {
+				continue
+			}
+			if assignment.WorkerID != "effervescent-peacock" {
+				return fmt.Errorf("barista demand covered by %s; want effervescent-peacock", assignment.WorkerID)
+			}
+			covered = true
+		}
+		if !covered {
+			return errors.New("barista demand not covered")
+		}
+	}
+
+	return nil
+}
+
+func TestGoldenLaborCost(t *testing.T) {
+	harness.FileTests(
+		t,
+		"labor-cost",
+		config(golden.Config{
+			Args: []string{
+				"-format.assignments",
+			},
+			DedicatedComparison: []string{
+				".solutions[0].status",
+				".solutions[0].value",
+				".solutions[0].assignments[0].worker_id",
+				".statistics.result.custom.coverage",
+				".statistics.result.custom.labor_cost",
+			},
+		}),
+	)
+}
+
+func TestGoldenFairness(t *testing.T) {
+	harness.FileTests(
+		t,
+		"fairness",
+		config(golden.Config{
+			Args: []string{
+				"-format.assignments",
+				"-fairnessweight", "1",
+			},
+			DedicatedComparison: []string{
+				".solutions[0].status",
+				".solutions[0].value",
+				".statistics.result.custom.coverage",
+			},
+			VerifyFunc: verifyFairness,
+		}),
+	)
+}
+
+// verifyFairness checks that both workers are assigned the same number of
+// hours.
+func verifyFairness(_, output []byte) error {
+	var out struct {
+		Solutions []struct {
+			Assignments []struct {
+				Start    time.Time `json:"start"`
+				End      time.Time `json:"end"`
+				WorkerID string    `json:"worker_id"`
+			} `json:"assignments"`
+		} `json:"solutions"`
+	}
+	if err := json.Unmarshal(output, &out); err != nil {
+		return err
+	}
+	for _, solution := range out.Solutions {
+		hours := map[string]float64{}
+		for _, assignment := range solution.Assignments {
+			hours[assignment.WorkerID] += assignment.End.Sub(assignment.Start).Hours()
+		}
+		if len(hours) != 2 || hours["ghastly-blobfish"] != hours["effervescent-peacock"] {
+			return fmt.Errorf("hours per worker: got %v; want the same for both workers", hours)
+		}
+	}
+
+	return nil
+}
+
+func TestGoldenFixedAssignments(t *testing.T) {
+	harness.FileTests(
+		t,
+		"fixed-assignments",
+		config(golden.Config{
+			Args: []string{
+				"-format.assignments",
 			},
-			ExecutionConfig: &golden.ExecutionConfig{
-				Command:    "go",
-				Args:       []string{"run", "."},
-				InputFlag:  "-runner.input.path",
-				OutputFlag: "-runner.output.path",
-				WorkDir:    "../../../shift-scheduling-gosdk",
+			DedicatedComparison: []string{
+				".solutions[0].status",
+				".solutions[0].value",
+				".statistics.result.custom.coverage",
+			},
+			VerifyFunc: verifyFixedAssignments,
+		}),
+	)
+}
+
+// verifyFixedAssignments checks that the fixed shift from 14:00 to 18:00 is the
+// only shift of its worker. The recovery time keeps the worker from covering
+// the demand in the morning as well.
+func verifyFixedAssignments(_, output []byte) error {
+	var out struct {
+		Solutions []struct {
+			Assignments []struct {
+				Start    time.Time `json:"start"`
+				End      time.Time `json:"end"`
+				WorkerID string    `json:"worker_id"`
+			} `json:"assignments"`
+		} `json:"solutions"`
+	}
+	if err := json.Unmarshal(output, &out); err != nil {
+		return err
+	}
+	start := time.Date(2023, 12, 10, 19, 0, 0, 0, time.UTC)
+	end := time.Date(2023, 12, 10, 23, 0, 0, 0, time.UTC)
+	for _, solution := range out.Solutions {
+		fixed := 0
+		for _, assignment := range solution.Assignments {
+			if assignment.WorkerID != "ghastly-blobfish" {
+				continue
+			}
+			if !assignment.Start.Equal(start) || !assignment.End.Equal(end) {
+				return fmt.Errorf("unexpected shift of ghastly-blobfish from %v to %v", assignment.Start, assignment.End)
+			}
+			fixed++
+		}
+		if fixed != 1 {
+			return fmt.Errorf("fixed shifts: got %d; want 1", fixed)
+		}
+	}
+
+	return nil
+}
+
+func TestGoldenRecoveryTime(t *testing.T) {
+	harness.FileTests(
+		t,
+		"recovery-time",
+		config(golden.Config{
+			Args: []string{
+				"-format.assignments",
 			},
+			DedicatedComparison: []string{
+				".solutions[0].status",
+				".solutions[0].value",
+				".statistics.result.custom.coverage",
+			},
+			VerifyFunc: verifyRecoveryTime,
+		}),
+	)
+}
+
+// assignedShift is a shift in the output in the assignments schema.
+type assignedShift struct {
+	Start time.Time `json:"start"`
+	End   time.Time `json:"end"`
+}
+
+// assignedShifts returns the assigned shifts of every solution in the output
+// in the assignments schema.
+func assignedShifts(output []byte) ([][]assignedShift, error) {
+	var out struct {
+		Solutions []struct {
+			Assignments []assignedShift `json:"assignments"`
+		} `json:"solutions"`
+	}
+	if err := json.Unmarshal(output, &out); err != nil {
+		return nil, err
+	}
+	shifts := make([][]assignedShift, len(out.Solutions))
+	for i, solution := range out.Solutions {
+		shifts[i] = solution.Assignments
+	}
+
+	return shifts, nil
+}
+
+// checkRecoveryTime returns an error if two of the shifts, which are assigned
+// to the same worker, are less than the recovery time of 8 hours apart.
+// Touching shifts are 0 hours apart.
+func checkRecoveryTime(shifts []assignedShift) error {
+	for i, a1 := range shifts {
+		for _, a2 := range shifts[i+1:] {
+			apart := max(a2.Start.Sub(a1.End), a1.Start.Sub(a2.End))
+			if apart < 8*time.Hour {
+				return fmt.Errorf(
+					"shifts starting at %v and %v: got %v apart; want at least 8h",
+					a1.Start, a2.Start, apart,
+				)
+			}
+		}
+	}
+
+	return nil
+}
+
+// verifyRecoveryTime checks that the assigned shifts of a worker are at least
+// the recovery time of 8 hours apart. The morning shift conflicts with both
+// the night and the noon shift, which are compatible with each other and cover
+// both demands.
+func verifyRecoveryTime(_, output []byte) error {
+	solutions, err := assignedShifts(output)
+	if err != nil {
+		return err
+	}
+	for _, shifts := range solutions {
+		if err := checkRecoveryTime(shifts); err != nil {
+			return err
+		}
+		if len(shifts) != 2 {
+			return fmt.Errorf("assignments: got %d; want 2", len(shifts))
+		}
+	}
+
+	return nil
+}
+
+// TestGoldenAdjacentShifts uses a worker available from 8 to 20 and demands
+// from 8 to 12 and from 12 to 20. Covering both would need touching shifts,
+// which are 0 hours apart and 12 hours long in total, so only one of them is
+// covered.
+func TestGoldenAdjacentShifts(t *testing.T) {
+	harness.FileTests(
+		t,
+		"adjacent-shifts",
+		config(golden.Config{
+			Args: []string{
+				"-format.assignments",
+			},
+			DedicatedComparison: []string{
+				".solutions[0].status",
+				".solutions[0].value",
+				".statistics.result.custom.coverage",
+			},
+			VerifyFunc: verifyAdjacentShifts,
+		}),
+	)
+}
+
+// verifyAdjacentShifts checks that the worker is not assigned touching shifts,
+// which violate both the recovery time and the daily maximum of 10 hours.
+func verifyAdjacentShifts(_, output []byte) error {
+	solutions, err := assignedShifts(output)
+	if err != nil {
+		return err
+	}
+	for _, shifts := range solutions {
+		if err := checkRecoveryTime(shifts); err != nil {
+			return err
+		}
+		hours := 0.0
+		for _, shift := range shifts {
+			hours += shift.End.Sub(shift.Start).Hours()
+		}
+		if hours > 10 {
+			return fmt.Errorf("hours: got %v; want at most 10", hours)
+		}
+		if len(shifts) != 1 {
+			return fmt.Errorf("assignments: got %d; want 1", len(shifts))
+		}
+	}
+
+	return nil
+}
+
+func TestGoldenGranularity(t *testing.T) {
+	harness.FileTests(
+		t,
+		"granularity",
+		config(golden.Config{
+			Args: []string{
+				"-format.assignments",
+				"-granularity", "1h",
+			},
+			DedicatedComparison: []string{
+				".solutions[0].status",
+				".solutions[0].value",
+				".statistics.result.custom.coverage",
+			},
+			VerifyFunc: verifyGranularity,
+		}),
+	)
+}
+
+// verifyGranularity checks that all shifts start and end on the full hour, as
+// the availabilities do.
+func verifyGranularity(_, output []byte) error {
+	var out struct {
+		Solutions []struct {
+			Assignments []struct {
+				Start time.Time `json:"start"`
+				End   time.Time `json:"end"`
+			} `json:"assignments"`
+		} `json:"solutions"`
+	}
+	if err := json.Unmarshal(output, &out); err != nil {
+		return err
+	}
+	for _, solution := range out.Solutions {
+		for _, assignment := range solution.Assignments {
+			if assignment.Start.Minute() != 0 || assignment.End.Minute() != 0 {
+				return fmt.Errorf("shift from %v to %v: want full hours", assignment.Start, assignment.End)
+			}
+		}
+	}
+
+	return nil
+}
+
+func TestGoldenUnavailability(t *testing.T) {
+	harness.FileTests(
+		t,
+		"unavailability",
+		config(golden.Config{
+			Args: []string{
+				"-format.assignments",
+			},
+			DedicatedComparison: []string{
+				".solutions[0].status",
+				".solutions[0].value",
+				".statistics.result.custom.coverage",
+			},
+			VerifyFunc: verifyUnavailability,
+		}),
+	)
+}
+
+// verifyUnavailability checks that no shift overlaps an unavailability of its
+// worker. Both demands are covered by shifts that touch one.
+func verifyUnavailability(_, output []byte) error {
+	var out struct {
+		Solutions []struct {
+			Assignments []struct {
+				Start    time.Time `json:"start"`
+				End      time.Time `json:"end"`
+				WorkerID string    `json:"worker_id"`
+			} `json:"assignments"`
+		} `json:"solutions"`
+		Statistics struct {
+			Result struct {
+				Custom struct {
+					Coverage float64 `json:"coverage"`
+				} `json:"custom"`
+			} `json:"result"`
+		} `json:"statistics"`
+	}
+	if err := json.Unmarshal(output, &out); err != nil {
+		return err
+	}
+	unavailable := map[string][2]time.Time{
+		"ghastly-blobfish": {
+			time.Date(2023, 12, 10, 17, 0, 0, 0, time.UTC),
+			time.Date(2023, 12, 10, 23, 0, 0, 0, time.UTC),
+		},
+		"effervescent-peacock": {
+			time.Date(2023, 12, 10, 13, 0, 0, 0, time.UTC),
+			time.Date(2023, 12, 10, 19, 0, 0, 0, time.UTC),
 		},
+	}
+	for _, solution := range out.Solutions {
+		for _, assignment := range solution.Assignments {
+			window := unavailable[assignment.WorkerID]
+			if assignment.Start.Before(window[1]) && assignment.End.After(window[0]) {
+				return fmt.Errorf(
+					"shift of %s from %v to %v overlaps its unavailability",
+					assignment.WorkerID, assignment.Start, assignment.End,
+				)
+			}
+		}
+	}
+	if coverage := out.Statistics.Result.Custom.Coverage; coverage != 1 {
+		return fmt.Errorf("coverage: got %v; want 1", coverage)
+	}
+
+	return nil
+}
+
+func TestGoldenOvertime(t *testing.T) {
+	harness.FileTests(
+		t,
+		"overtime",
+		config(golden.Config{
+			Args: []string{
+				"-format.assignments",
+				"-limits.shift.maxduration", "10h",
+				"-limits.day.overtimethreshold", "8h",
+			},
+			DedicatedComparison: []string{
+				".solutions[0].status",
+				".solutions[0].value",
+				".solutions[0].assignments[0].worker_id",
+				".statistics.result.custom.coverage",
+				".statistics.result.custom.labor_cost",
+				".statistics.result.custom.overtime_hours",
+				".statistics.result.custom.overtime_cost",
+			},
+		}),
+	)
+}
+
+func TestGoldenLocations(t *testing.T) {
+	harness.FileTests(
+		t,
+		"locations",
+		config(golden.Config{
+			Args: []string{
+				"-format.assignments",
+			},
+			DedicatedComparison: []string{
+				".solutions[0].status",
+				".solutions[0].value",
+				".statistics.result.custom.coverage",
+			},
+			VerifyFunc: verifyLocations,
+		}),
+	)
+}
+
+// verifyLocations checks that the demand in the morning at store-b is only
+// covered by its worker and the demand in the afternoon at store-a only by
+// its worker.
+func verifyLocations(_, output []byte) error {
+	var out struct {
+		Solutions []struct {
+			Assignments []struct {
+				Start    time.Time `json:"start"`
+				End      time.Time `json:"end"`
+				WorkerID string    `json:"worker_id"`
+			} `json:"assignments"`
+		} `json:"solutions"`
+	}
+	if err := json.Unmarshal(output, &out); err != nil {
+		return err
+	}
+	demands := []struct {
+		start, end time.Time
+		workerID   string
+	}{
+		{
+			time.Date(2023, 12, 10, 13, 0, 0, 0, time.UTC),
+			time.Date(2023, 12, 10, 17, 0, 0, 0, time.UTC),
+			"effervescent-peacock",
+		},
+		{
+			time.Date(2023, 12, 10, 19, 0, 0, 0, time.UTC),
+			time.Date(2023, 12, 10, 23, 0, 0, 0, time.UTC),
+			"ghastly-blobfish",
+		},
+	}
+	for _, solution := range out.Solutions {
+		for _, demand := range demands {
+			covered := false
+			for _, assignment := range solution.Assignments {
+				if assignment.Start.After(demand.start) || assignment.End.Before(demand.end) {
+					continue
+				}
+				if assignment.WorkerID != demand.workerID {
+					return fmt.Errorf("demand at %v covered by %s; want %s", demand.start, assignment.WorkerID, demand.workerID)
+				}
+				covered = true
+			}
+			if !covered {
+				return fmt.Errorf("demand at %v not covered", demand.start)
+			}
+		}
+	}
+
+	return nil
+}
+
+func TestGoldenGap(t *testing.T) {
+	harness.FileTests(
+		t,
+		"gap",
+		config(golden.Config{
+			Args: []string{
+				"-format.assignments",
+				"-solve.mip.gap.relative", "0.05",
+			},
+			DedicatedComparison: []string{
+				".solutions[0].status",
+				".solutions[0].value",
+				".solutions[0].assignments[0].worker_id",
+				".statistics.result.custom.coverage",
+				".statistics.result.custom.status",
+				".statistics.result.custom.gap",
+			},
+		}),
+	)
+}
+
+func TestGoldenSummaries(t *testing.T) {
+	harness.FileTests(
+		t,
+		"summaries",
+		config(golden.Config{
+			DedicatedComparison: []string{
+				".statistics.result.value",
+				".solutions[0].number_assigned_workers",
+			},
+			VerifyFunc: verifySummaries,
+		}),
+	)
+}
+
+// verifySummaries checks that the worker summaries add up the assigned shifts
+// and that the demand coverage reports all demands as covered.
+func verifySummaries(_, output []byte) error {
+	var out struct {
+		Solutions []struct {
+			AssignedShifts []struct {
+				Start    time.Time `json:"start"`
+				End      time.Time `json:"end"`
+				WorkerID string    `json:"worker_id"`
+			} `json:"assigned_shifts"`
+			WorkerSummaries []struct {
+				WorkerID      string  `json:"worker_id"`
+				AssignedHours float64 `json:"assigned_hours"`
+				Shifts        int     `json:"shifts"`
+			} `json:"worker_summaries"`
+			DemandCoverage []struct {
+				Required int `json:"required"`
+				Covered  int `json:"covered"`
+			} `json:"demand_coverage"`
+		} `json:"solutions"`
+	}
+	if err := json.Unmarshal(output, &out); err != nil {
+		return err
+	}
+	for _, solution := range out.Solutions {
+		hours := map[string]float64{}
+		shifts := map[string]int{}
+		for _, shift := range solution.AssignedShifts {
+			hours[shift.WorkerID] += shift.End.Sub(shift.Start).Hours()
+			shifts[shift.WorkerID]++
+		}
+		if len(solution.WorkerSummaries) != 2 {
+			return fmt.Errorf("got %d worker summaries; want 2", len(solution.WorkerSummaries))
+		}
+		for _, summary := range solution.WorkerSummaries {
+			if math.Abs(summary.AssignedHours-hours[summary.WorkerID]) > 1e-6 ||
+				summary.Shifts != shifts[summary.WorkerID] {
+				return fmt.Errorf(
+					"worker %s: got %v hours in %d shifts; want %v hours in %d shifts",
+					summary.WorkerID, summary.AssignedHours, summary.Shifts,
+					hours[summary.WorkerID], shifts[summary.WorkerID],
+				)
+			}
+		}
+		if len(solution.DemandCoverage) != 2 {
+			return fmt.Errorf("got %d demand windows; want 2", len(solution.DemandCoverage))
+		}
+		for i, coverage := range solution.DemandCoverage {
+			if coverage.Covered != coverage.Required {
+				return fmt.Errorf("demand %d: covered %d; want %d", i, coverage.Covered, coverage.Required)
+			}
+		}
+	}
+
+	return nil
+}
+
+func TestGoldenTemplateDurations(t *testing.T) {
+	harness.FileTests(
+		t,
+		"template-durations",
+		config(golden.Config{
+			Args: []string{
+				"-format.assignments",
+			},
+			DedicatedComparison: []string{
+				".solutions[0].status",
+				".solutions[0].value",
+				".solutions[0].assignments[0].worker_id",
+				".statistics.result.custom.coverage",
+			},
+			VerifyFunc: verifyTemplateDurations,
+		}),
+	)
+}
+
+// verifyTemplateDurations checks that all shifts are instances of the half-day
+// template.
+func verifyTemplateDurations(_, output []byte) error {
+	var out struct {
+		Solutions []struct {
+			Assignments []struct {
+				Start           time.Time `json:"start"`
+				End             time.Time `json:"end"`
+				ShiftTemplateID string    `json:"shift_template_id"`
+			} `json:"assignments"`
+		} `json:"solutions"`
+	}
+	if err := json.Unmarshal(output, &out); err != nil {
+		return err
+	}
+	for _, solution := range out.Solutions {
+		for _, assignment := range solution.Assignments {
+			if assignment.ShiftTemplateID != "half-day" || assignment.End.Sub(assignment.Start) != 4*time.Hour {
+				return fmt.Errorf(
+					"shift from %v to %v of template %q is not a half-day shift",
+					assignment.Start, assignment.End, assignment.ShiftTemplateID,
+				)
+			}
+		}
+	}
+
+	return nil
+}
+
+func TestGoldenMinHours(t *testing.T) {
+	harness.FileTests(
+		t,
+		"min-hours",
+		config(golden.Config{
+			DedicatedComparison: []string{
+				".statistics.result.value",
+				".solutions[0].number_assigned_workers",
+			},
+			VerifyFunc: verifyMinHours,
+		}),
+	)
+}
+
+// verifyMinHours checks that the worker with minimum weekly hours gets them,
+// even though one worker suffices to cover the demand.
+func verifyMinHours(_, output []byte) error {
+	var out struct {
+		Solutions []struct {
+			WorkerSummaries []struct {
+				WorkerID          string  `json:"worker_id"`
+				AssignedHours     float64 `json:"assigned_hours"`
+				MinHoursShortfall float64 `json:"min_hours_shortfall"`
+			} `json:"worker_summaries"`
+		} `json:"solutions"`
+	}
+	if err := json.Unmarshal(output, &out); err != nil {
+		return err
+	}
+	for _, solution := range out.Solutions {
+		for _, summary := range solution.WorkerSummaries {
+			if summary.MinHoursShortfall != 0 {
+				return fmt.Errorf("worker %s: got shortfall %v; want 0", summary.WorkerID, summary.MinHoursShortfall)
+			}
+			if summary.WorkerID == "ghastly-blobfish" && summary.AssignedHours < 6 {
+				return fmt.Errorf("worker %s: got %v hours; want at least 6", summary.WorkerID, summary.AssignedHours)
+			}
+		}
+	}
+
+	return nil
+}
+
+func TestGoldenMaxWorkers(t *testing.T) {
+	harness.FileTests(
+		t,
+		"max-workers",
+		config(golden.Config{
+			Args: []string{
+				"-format.assignments",
+				"-maxworkers", "1",
+			},
+			DedicatedComparison: []string{
+				".solutions[0].status",
+				".solutions[0].value",
+				".statistics.result.custom.coverage",
+				".statistics.result.custom.under_supply_penalty",
+			},
+			VerifyFunc: verifyMaxWorkers,
+		}),
+	)
+}
+
+// verifyMaxWorkers checks that a single worker is assigned, leaving the demand
+// for two workers half covered.
+func verifyMaxWorkers(_, output []byte) error {
+	var out struct {
+		Solutions []struct {
+			Assignments []struct {
+				WorkerID string `json:"worker_id"`
+			} `json:"assignments"`
+		} `json:"solutions"`
+		Statistics struct {
+			Result struct {
+				Custom struct {
+					Coverage float64 `json:"coverage"`
+				} `json:"custom"`
+			} `json:"result"`
+		} `json:"statistics"`
+	}
+	if err := json.Unmarshal(output, &out); err != nil {
+		return err
+	}
+	for _, solution := range out.Solutions {
+		workers := map[string]struct{}{}
+		for _, assignment := range solution.Assignments {
+			workers[assignment.WorkerID] = struct{}{}
+		}
+		if len(workers) != 1 {
+			return fmt.Errorf("got %d assigned workers; want 1", len(workers))
+		}
+	}
+	if coverage := out.Statistics.Result.Custom.Coverage; coverage != 0.5 {
+		return fmt.Errorf("got coverage %v; want 0.5", coverage)
+	}
+
+	return nil
+}
+
+func TestGoldenWeekStart(t *testing.T) {
+	harness.FileTests(
+		t,
+		"week-start",
+		config(golden.Config{
+			Args: []string{
+				"-format.assignments",
+				// Only the weekly limit is under test: 32h from Thursday to
+				// Sunday and 24h from Monday to Wednesday.
+				"-limits.day.maxduration", "24h",
+			},
+			DedicatedComparison: []string{
+				".solutions[0].status",
+				".solutions[0].value",
+				".statistics.result.custom.coverage",
+			},
+		}),
 	)
 }
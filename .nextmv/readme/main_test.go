@@ -1,6 +1,7 @@
 package mip
 
 import (
+	"flag"
 	"os"
 	"slices"
 	"strings"
@@ -17,6 +18,10 @@ func TestMain(m *testing.M) {
 
 const configFile = "workflow-configuration.yml"
 
+// parallel bounds the number of apps that are tested concurrently, to avoid
+// running too many solvers at once.
+var parallel = flag.Int("apps.parallel", 4, "maximum number of apps tested concurrently")
+
 type ScriptConfig struct {
 	Name   string `yaml:"name"`
 	Silent bool   `yaml:"silent"`
@@ -25,6 +30,7 @@ type ScriptConfig struct {
 
 type AppConfig struct {
 	Name    string         `yaml:"name"`
+	Serial  bool           `yaml:"serial"`
 	Scripts []ScriptConfig `yaml:"scripts"`
 }
 
@@ -32,6 +38,15 @@ type Config struct {
 	Apps []AppConfig `yaml:"apps"`
 }
 
+func (s Config) appConfig(app string) AppConfig {
+	for _, appConfig := range s.Apps {
+		if appConfig.Name == app {
+			return appConfig
+		}
+	}
+	return AppConfig{}
+}
+
 func (s Config) scriptConfig(app string, script string) ScriptConfig {
 	for _, appConfig := range s.Apps {
 		if appConfig.Name == app {
@@ -66,7 +81,11 @@ func TestGolden(t *testing.T) {
 		{Regex: `xpress\.init\(.*\)`, Replacement: `xpress.init("path/to/xpress")`},
 	}
 
-	// Run all readme tests
+	// Run all readme tests. Apps run in parallel, unless they are marked as
+	// serial, e.g. because they share build artifacts. Serial apps run one
+	// after the other before the parallel ones start. The scripts of an app
+	// always run in order.
+	semaphore := make(chan struct{}, *parallel)
 	dirs, err := os.ReadDir(".")
 	if err != nil {
 		t.Fatalf("error reading directory: %v", err)
@@ -94,25 +113,33 @@ func TestGolden(t *testing.T) {
 		}
 		slices.Sort(scripts)
 
-		// Run all scripts of the app
-		for _, script := range scripts {
-			scriptConfig := config.scriptConfig(app, script)
-			if scriptConfig.Skip {
-				continue
+		t.Run(app, func(t *testing.T) {
+			if !config.appConfig(app).Serial {
+				t.Parallel()
+				semaphore <- struct{}{}
+				defer func() { <-semaphore }()
 			}
-			t.Run(app+"/"+script, func(t *testing.T) {
-				golden.BashTestFile(
-					t,
-					app+"/"+script,
-					golden.BashConfig{
-						DisplayStdout: !scriptConfig.Silent,
-						WorkingDir:    "../../" + app,
-						OutputProcessConfig: golden.OutputProcessConfig{
-							VolatileRegexReplacements: replacements,
+
+			// Run all scripts of the app
+			for _, script := range scripts {
+				scriptConfig := config.scriptConfig(app, script)
+				if scriptConfig.Skip {
+					continue
+				}
+				t.Run(script, func(t *testing.T) {
+					golden.BashTestFile(
+						t,
+						app+"/"+script,
+						golden.BashConfig{
+							DisplayStdout: !scriptConfig.Silent,
+							WorkingDir:    "../../" + app,
+							OutputProcessConfig: golden.OutputProcessConfig{
+								VolatileRegexReplacements: replacements,
+							},
 						},
-					},
-				)
-			})
-		}
+					)
+				})
+			}
+		})
 	}
 }
@@ -39,6 +39,12 @@ def main() -> None:
         default=3000,
         help="A penalty added to the edges from dummy source to projects. Default is 3000.",
     )
+    parser.add_argument(
+        "-strict",
+        action="store_true",
+        help="Reject inputs whose available and required time units differ instead of absorbing the difference "
+        "with a dummy source and sink. Default is false.",
+    )
     args = parser.parse_args()
 
     # Read input data, solve the problem and write the solution.
@@ -47,11 +53,12 @@ def main() -> None:
     log(f"  - projects: {len(input_data.get('projects', []))}")
     log(f"  - workers: {len(input_data.get('workers', []))}")
     log(f"  - penalty: {args.penalty}")
-    solution = solve(input_data, float(args.penalty))
+    log(f"  - strict: {args.strict}")
+    solution = solve(input_data, float(args.penalty), args.strict)
     write_output(args.output, solution)
 
 
-def solve(input_data: dict[str, Any], penalty: float) -> dict[str, Any]:
+def solve(input_data: dict[str, Any], penalty: float, strict: bool) -> dict[str, Any]:
     """Solves the given problem and returns the solution."""
 
     err = validateSkills(input_data)
@@ -71,6 +78,17 @@ def solve(input_data: dict[str, Any], penalty: float) -> dict[str, Any]:
         project_to_open_time_units[project["id"]] = project["required_time"]
         project_to_value[project["id"]] = project["value"]
 
+    # A difference between the supply and the demand is absorbed by the dummy
+    # source and sink below and reported as excess or unmet time units. In
+    # strict mode, it is rejected instead.
+    if total_available_time != total_required_time and strict:
+        message = (
+            f"the available time units ({total_available_time}) do not match the required time units "
+            f"({total_required_time}), omit -strict to absorb the difference"
+        )
+        log(f"  - error: {message}")
+        return errorStatusOutput("input_imbalance_error", message)
+
     start_nodes = []
     end_nodes = []
     capacities = []
@@ -145,6 +163,12 @@ def solve(input_data: dict[str, Any], penalty: float) -> dict[str, Any]:
             capacities.append(total_required_time - total_available_time)
         unit_costs.append(penalty)
 
+    # name the nodes for the flows in the solution: the structure nodes, then
+    # the workers and the projects
+    node_names = ["source", "sink", "dummy_source", "dummy_sink"]
+    node_names += [worker["id"] for worker in input_data["workers"]]
+    node_names += [project["id"] for project in input_data["projects"]]
+
     solver = min_cost_flow.SimpleMinCostFlow()
 
     all_arcs = solver.add_arcs_with_capacity_and_unit_cost(
@@ -194,7 +218,8 @@ def solve(input_data: dict[str, Any], penalty: float) -> dict[str, Any]:
     }
 
     # create the solution information
-    # flows: just lists all edges and their flows
+    # flows: lists the edges that carry flow, with their named endpoints, their
+    # flows and unit costs
     # assignments: which worker is assigned to which project
     # value: what is the actual value of projects that can be
     # fulfilled (only considers projects that don't need the dummy source)
@@ -203,15 +228,19 @@ def solve(input_data: dict[str, Any], penalty: float) -> dict[str, Any]:
         total_value = 0
         fulfilled_projects = 0
         for i in range(0, len(solution_flows)):
-            solution["flows"].append(
-                {
-                    "from": start_nodes[i],
-                    "to": end_nodes[i],
-                    "flow": int(solution_flows[i]),
-                    "capacity": int(capacities[i]),
-                    "value": int(costs[i])
-                }
-            )
+            if solution_flows[i] > 0:
+                solution["flows"].append(
+                    {
+                        "from": start_nodes[i],
+                        "to": end_nodes[i],
+                        "source": node_names[start_nodes[i]],
+                        "target": node_names[end_nodes[i]],
+                        "flow": int(solution_flows[i]),
+                        "capacity": int(capacities[i]),
+                        "unit_cost": unit_costs[i],
+                        "value": int(costs[i])
+                    }
+                )
 
             # look at the flows between workers and projects to get the assignments
             if solution_flows[i] > 0 and start_nodes[i] != 0 \
@@ -261,10 +290,11 @@ def validateSkills(input_data: dict[str, Any]) -> Any:
                 return errorStatusOutput("input_skill_error")
     return None
 
-def errorStatusOutput(status: str) -> dict[str, Any]:
-    """Returns an error output with a given status."""
+def errorStatusOutput(status: str, message: str = "") -> dict[str, Any]:
+    """Returns an error output with a given status and an optional message
+    that explains it."""
 
-    return {
+    output = {
             "solution": {
                 "flows": [],
                 "assignments": [],
@@ -293,6 +323,10 @@ def errorStatusOutput(status: str) -> dict[str, Any]:
                 "schema": "v1",
             }
         }
+    if message:
+        output["solution"]["message"] = message
+
+    return output
 
 
 def log(message: str) -> None:
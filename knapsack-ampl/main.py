@@ -103,6 +103,10 @@ def solve(input_data: dict[str, Any], duration: int, provider: str) -> dict[str,
     # Activate license.
     license_used = activate_license()
 
+    # Reads the scenarios of the item values. Without scenarios, the values of
+    # the items are the only scenario.
+    scenarios = read_scenarios(input_data)
+
     # Defines the model.
     ampl = AMPL()
     ampl.set_output_handler(output_handler)
@@ -111,17 +115,20 @@ def solve(input_data: dict[str, Any], duration: int, provider: str) -> dict[str,
         r"""
         # Sets
         set I; # Set of items.
+        set S; # Set of scenarios.
 
         # Parameters
         param W >= 0; # Maximum weight capacity.
-        param v {I} >= 0; # Value of each item.
+        param p {S} >= 0; # Probability of each scenario.
+        param v {I, S} >= 0; # Value of each item in each scenario.
         param w {I} >= 0; # Weight of each item.
 
         # Variables
         var x {I} binary; # 1 if item is selected, 0 otherwise.
 
-        # Objective
-        maximize z: sum {i in I} v[i] * x[i];
+        # Objective: the expected value over the scenarios, which share the
+        # selection of the items.
+        maximize z: sum {s in S} p[s] * sum {i in I} v[i, s] * x[i];
 
         # Constraints
         s.t. weight_limit: sum {i in I} w[i] * x[i] <= W;
@@ -135,8 +142,12 @@ def solve(input_data: dict[str, Any], duration: int, provider: str) -> dict[str,
 
     # Set the data on the model.
     ampl.set["I"] = [item["id"] for item in input_data["items"]]
+    ampl.set["S"] = [scenario["id"] for scenario in scenarios]
     ampl.param["W"] = input_data["weight_capacity"]
-    ampl.param["v"] = {item["id"]: item["value"] for item in input_data["items"]}
+    ampl.param["p"] = {scenario["id"]: scenario["probability"] for scenario in scenarios}
+    ampl.param["v"] = {
+        (item_id, scenario["id"]): value for scenario in scenarios for item_id, value in scenario["values"].items()
+    }
     ampl.param["w"] = {item["id"]: item["weight"] for item in input_data["items"]}
 
     # Solves the problem. Verbose mode is turned off to avoid printing to
@@ -181,12 +192,60 @@ def solve(input_data: dict[str, Any], duration: int, provider: str) -> dict[str,
         "schema": "v1",
     }
 
+    # Reports the value that the chosen items realize in every scenario, if
+    # the input defines scenarios.
+    if "scenarios" in input_data:
+        statistics["result"]["custom"]["expected_value"] = value.value()
+        statistics["result"]["custom"]["scenarios"] = [
+            {
+                "id": scenario["id"],
+                "probability": scenario["probability"],
+                "value": sum(scenario["values"][item["id"]] for item in chosen_items),
+            }
+            for scenario in scenarios
+        ]
+
     return {
         "solutions": [{"items": chosen_items}],
         "statistics": statistics,
     }
 
 
+def read_scenarios(input_data: dict[str, Any]) -> list[dict[str, Any]]:
+    """
+    Reads the scenarios of the item values from the input. Every scenario has
+    an id, a probability and the values of the items in it. Items without a
+    value in a scenario keep their value. Without scenarios in the input, the
+    values of the items are the only scenario, with a probability of 1.
+
+    Raises:
+        ValueError: If a scenario values an unknown item, a probability is
+        negative or the probabilities do not sum up to 1.
+    """
+
+    item_values = {item["id"]: item["value"] for item in input_data["items"]}
+    if "scenarios" not in input_data:
+        return [{"id": "base", "probability": 1, "values": item_values}]
+
+    scenarios = []
+    for scenario in input_data["scenarios"]:
+        probability = scenario["probability"]
+        if probability < 0:
+            raise ValueError(f"scenario {scenario['id']}: probability must not be negative, got {probability}")
+        values = dict(item_values)
+        for item_id, value in scenario.get("values", {}).items():
+            if item_id not in item_values:
+                raise ValueError(f"scenario {scenario['id']}: unknown item {item_id}")
+            values[item_id] = value
+        scenarios.append({"id": scenario["id"], "probability": probability, "values": values})
+
+    total = sum(scenario["probability"] for scenario in scenarios)
+    if abs(total - 1) > 1e-6:
+        raise ValueError(f"the probabilities of the scenarios must sum up to 1, got {total}")
+
+    return scenarios
+
+
 def activate_license() -> str:
     """
     Activates de AMPL license based on the use case for the app. If there is a
@@ -3,12 +3,16 @@ package main
 
 import (
 	"context"
+	"fmt"
 	"log"
+	"math"
+	"sort"
 
 	"github.com/nextmv-io/go-highs"
 	"github.com/nextmv-io/go-mip"
 	"github.com/nextmv-io/sdk/run"
 	"github.com/nextmv-io/sdk/run/schema"
+	"github.com/nextmv-io/sdk/run/statistics"
 )
 
 // This template demonstrates how to solve a Mixed Integer Programming problem.
@@ -24,31 +28,176 @@ func main() {
 
 // The options for the solver.
 type options struct {
+	Statistics struct {
+		Model bool `json:"model" usage:"report constraint matrix statistics of the model"`
+	} `json:"statistics,omitempty"`
 	Solve mip.SolveOptions `json:"solve,omitempty"`
+	// SecondaryObjective is optimized among the solutions of maximum profit.
+	SecondaryObjective string `json:"secondary_objective" default:"none" usage:"{none, min_weight, max_count} tie-breaker"`
 }
 
-// Input of the problem.
+// Secondary objectives that are optimized after the profit.
+const (
+	secondaryNone      = "none"
+	secondaryMinWeight = "min_weight"
+	secondaryMaxCount  = "max_count"
+)
+
+// Input of the problem. Capacities holds the weight capacity of each of
+// several knapsacks. If it is empty, there is a single knapsack with the given
+// WeightCapacity. VolumeCapacity limits the volume of every knapsack, a
+// capacity of 0 means that the volume is not limited. CategoryLimits caps how
+// many items of a category are taken, categories without a limit are
+// unlimited. Conflicts lists pairs of item IDs that must not be packed into the
+// same knapsack. Synergies add a bonus if both items of a pair are taken.
 type input struct {
-	Items          []item  `json:"items"`
-	WeightCapacity float64 `json:"weight_capacity"`
+	Items          []item         `json:"items"`
+	WeightCapacity float64        `json:"weight_capacity,omitempty"`
+	Capacities     []float64      `json:"capacities,omitempty"`
+	VolumeCapacity float64        `json:"volume_capacity,omitempty"`
+	CategoryLimits map[string]int `json:"category_limits,omitempty"`
+	Conflicts      [][2]string    `json:"conflicts,omitempty"`
+	Synergies      []synergy      `json:"synergies,omitempty"`
 }
 
-// An item has a Value and Weight. ID is used to identify the item.
+// A synergy is a bonus for taking both items A and B, e.g. complementary
+// products that are worth more together than apart.
+type synergy struct {
+	A     string  `json:"a"`
+	B     string  `json:"b"`
+	Bonus float64 `json:"bonus"`
+}
+
+// capacities returns the weight capacity of every knapsack.
+func (i input) capacities() []float64 {
+	if len(i.Capacities) > 0 {
+		return i.Capacities
+	}
+	return []float64{i.WeightCapacity}
+}
+
+// An item has a Value, Weight and Volume. ID is used to identify the item. The
+// Cost of an item is netted against its value. By default an item is taken at
+// most once. Required items are always taken. Min and Max bound how many times
+// an item is taken, the chosen number is reported as Quantity for such items.
+// With several knapsacks, KnapsackID reports the index of the knapsack the item
+// is packed into.
 type item struct {
-	ID     string  `json:"id,omitempty"`
-	Value  float64 `json:"value"`
-	Weight float64 `json:"weight"`
+	ID         string  `json:"id,omitempty"`
+	Value      float64 `json:"value"`
+	Cost       float64 `json:"cost,omitempty"`
+	Weight     float64 `json:"weight"`
+	Volume     float64 `json:"volume,omitempty"`
+	Category   string  `json:"category,omitempty"`
+	Min        int     `json:"min,omitempty"`
+	Max        int     `json:"max,omitempty"`
+	Required   bool    `json:"required,omitempty"`
+	Quantity   int     `json:"quantity,omitempty"`
+	KnapsackID *int    `json:"knapsack_id,omitempty"`
+}
+
+// isBounded returns true if the item defines a minimum or maximum quantity.
+func (i item) isBounded() bool {
+	return i.Min > 0 || i.Max > 0
+}
+
+// taken returns how many times the item is taken in a solution.
+func (i item) taken() int {
+	if i.Quantity > 0 {
+		return i.Quantity
+	}
+	return 1
+}
+
+// minQuantity returns how many times the item must be taken at least.
+func (i item) minQuantity() int {
+	if i.Required {
+		return max(i.Min, 1)
+	}
+	return i.Min
+}
+
+// maxQuantity returns how many times the item can be taken at most. An item
+// with a minimum but no maximum is only limited by how many times it fits into
+// the knapsacks by weight and volume. If neither limits it, it is taken at
+// most its minimum number of times.
+func (i item) maxQuantity(input input) int {
+	if i.Max > 0 {
+		return i.Max
+	}
+	if i.Min == 0 {
+		return 1
+	}
+
+	limit := math.Inf(1)
+	if i.Weight > 0 {
+		weightCapacity := 0.0
+		for _, capacity := range input.capacities() {
+			weightCapacity += capacity
+		}
+		limit = math.Floor(weightCapacity / i.Weight)
+	}
+	if i.Volume > 0 && input.VolumeCapacity > 0 {
+		volumeCapacity := input.VolumeCapacity * float64(len(input.capacities()))
+		limit = math.Min(limit, math.Floor(volumeCapacity/i.Volume))
+	}
+	if math.IsInf(limit, 1) {
+		return i.Min
+	}
+	return max(int(limit), i.Min)
 }
 
 // solution represents the decisions made by the solver.
 type solution struct {
 	Items []item `json:"items,omitempty"`
+	// UnselectedItems are the items that are not taken at all.
+	UnselectedItems []item `json:"unselected_items,omitempty"`
+	// RemainingCapacity is the weight capacity of all knapsacks that is left
+	// after packing the items.
+	RemainingCapacity float64 `json:"remaining_capacity"`
+	// Synergies are the synergies whose items are both taken.
+	Synergies []synergy `json:"synergies,omitempty"`
+}
+
+// customResultStatistics extends the default custom statistics with the cost
+// of the taken items, the share of the capacities used and optional statistics
+// about the model.
+type customResultStatistics struct {
+	mip.CustomResultStatistics
+	TotalCost         float64          `json:"total_cost"`
+	SecondaryValue    *float64         `json:"secondary_value,omitempty"`
+	WeightUtilization float64          `json:"weight_utilization"`
+	VolumeUtilization float64          `json:"volume_utilization,omitempty"`
+	Model             *modelStatistics `json:"model,omitempty"`
+}
+
+// modelStatistics describes the constraint matrix of a MIP model. The
+// coefficient magnitudes help to flag numerical scaling issues.
+type modelStatistics struct {
+	Variables      int     `json:"variables"`
+	Constraints    int     `json:"constraints"`
+	Nonzeros       int     `json:"nonzeros"`
+	Density        float64 `json:"density"`
+	MinCoefficient float64 `json:"min_coefficient"`
+	MaxCoefficient float64 `json:"max_coefficient"`
 }
 
 // solver is the entrypoint of the program where a model is defined and solved.
 func solver(_ context.Context, input input, options options) (schema.Output, error) {
+	switch options.SecondaryObjective {
+	case secondaryNone, secondaryMinWeight, secondaryMaxCount:
+	default:
+		return schema.Output{}, fmt.Errorf(
+			"unknown secondary objective %q, want one of %q, %q or %q",
+			options.SecondaryObjective, secondaryNone, secondaryMinWeight, secondaryMaxCount,
+		)
+	}
+
 	// Translate the input to a MIP model.
-	model, variables := model(input)
+	model, variables, err := model(input)
+	if err != nil {
+		return schema.Output{}, err
+	}
 
 	// Create a solver.
 	solver := highs.NewSolver(model)
@@ -59,64 +208,462 @@ func solver(_ context.Context, input input, options options) (schema.Output, err
 		return schema.Output{}, err
 	}
 
+	// Optionally, optimize the secondary objective among the solutions of
+	// maximum profit. The objective value reported is the profit.
+	var primaryValue, secondaryValue *float64
+	if options.SecondaryObjective != secondaryNone && solution.HasValues() {
+		value := solution.ObjectiveValue()
+		primaryValue = &value
+		setSecondaryObjective(model, input, variables, options.SecondaryObjective, value)
+		secondary, err := highs.NewSolver(model).Solve(options.Solve)
+		if err != nil {
+			return schema.Output{}, err
+		}
+		if secondary.HasValues() {
+			solution = secondary
+			value := secondary.ObjectiveValue()
+			secondaryValue = &value
+		}
+	}
+
 	// Format the solution into the desired output format and add custom
 	// statistics.
-	output := mip.Format(options, format(input, solution, variables), solution)
-	output.Statistics.Result.Custom = mip.DefaultCustomResultStatistics(model, solution)
+	formatted := format(input, solution, variables)
+	output := mip.Format(options, formatted, solution)
+	if primaryValue != nil {
+		value := statistics.Float64(*primaryValue)
+		output.Statistics.Result.Value = &value
+	}
+	custom := customResultStatistics{
+		CustomResultStatistics: mip.DefaultCustomResultStatistics(model, solution),
+		SecondaryValue:         secondaryValue,
+	}
+	custom.WeightUtilization, custom.VolumeUtilization = utilization(input, formatted)
+	for _, item := range formatted.Items {
+		custom.TotalCost += item.Cost * float64(item.taken())
+	}
+	if options.Statistics.Model {
+		custom.Model = newModelStatistics(model)
+	}
+	output.Statistics.Result.Custom = custom
 
 	return output, nil
 }
 
+// setSecondaryObjective keeps the profit at the given value with a constraint
+// and replaces the objective of the model by the secondary objective. The
+// objective cannot be cleared, so the profit terms are canceled out.
+func setSecondaryObjective(
+	model mip.Model,
+	input input,
+	itemVariables map[string][]mip.Int,
+	secondaryObjective string,
+	profit float64,
+) {
+	// profit >= value of the primary solve, with a small tolerance
+	primary := model.NewConstraint(mip.GreaterThanOrEqual, profit-1e-6*math.Max(1, math.Abs(profit)))
+	for _, term := range model.Objective().Terms() {
+		primary.NewTerm(term.Coefficient(), term.Var())
+		model.Objective().NewTerm(-term.Coefficient(), term.Var())
+	}
+
+	switch secondaryObjective {
+	case secondaryMinWeight:
+		model.Objective().SetMinimize()
+		for _, item := range input.Items {
+			for _, variable := range itemVariables[item.ID] {
+				model.Objective().NewTerm(item.Weight, variable)
+			}
+		}
+	case secondaryMaxCount:
+		model.Objective().SetMaximize()
+		for _, item := range input.Items {
+			for _, variable := range itemVariables[item.ID] {
+				model.Objective().NewTerm(1, variable)
+			}
+		}
+	}
+}
+
+// utilization returns the share of the total weight and volume capacity of the
+// knapsacks that is used by the solution.
+func utilization(input input, solution solution) (weight, volume float64) {
+	capacities := input.capacities()
+	weightCapacity := 0.0
+	for _, capacity := range capacities {
+		weightCapacity += capacity
+	}
+	volumeCapacity := input.VolumeCapacity * float64(len(capacities))
+
+	for _, item := range solution.Items {
+		weight += item.Weight * float64(item.taken())
+		volume += item.Volume * float64(item.taken())
+	}
+
+	if weightCapacity > 0 {
+		weight /= weightCapacity
+	}
+	// Without a volume capacity, the volume utilization is not reported.
+	if volumeCapacity > 0 {
+		volume /= volumeCapacity
+	} else {
+		volume = 0
+	}
+
+	return weight, volume
+}
+
+// newModelStatistics computes the statistics of the constraint matrix of the
+// given model.
+func newModelStatistics(model mip.Model) *modelStatistics {
+	stats := &modelStatistics{
+		Variables:   len(model.Vars()),
+		Constraints: len(model.Constraints()),
+	}
+
+	minCoefficient := math.Inf(1)
+	maxCoefficient := 0.0
+	for _, constraint := range model.Constraints() {
+		for _, term := range constraint.Terms() {
+			magnitude := math.Abs(term.Coefficient())
+			if magnitude == 0 {
+				continue
+			}
+			stats.Nonzeros++
+			minCoefficient = math.Min(minCoefficient, magnitude)
+			maxCoefficient = math.Max(maxCoefficient, magnitude)
+		}
+	}
+
+	if stats.Nonzeros > 0 {
+		stats.MinCoefficient = minCoefficient
+		stats.MaxCoefficient = maxCoefficient
+	}
+	if cells := stats.Variables * stats.Constraints; cells > 0 {
+		stats.Density = float64(stats.Nonzeros) / float64(cells)
+	}
+
+	return stats
+}
+
 // model creates a MIP model from the input. It also returns the decision
-// variables.
-func model(input input) (mip.Model, map[string]mip.Bool) {
+// variables per item, one for each knapsack. An error is returned if the item
+// bounds cannot be satisfied.
+func model(input input) (mip.Model, map[string][]mip.Int, error) {
+	if err := validateBounds(input); err != nil {
+		return nil, nil, err
+	}
+	if err := validateConflicts(input); err != nil {
+		return nil, nil, err
+	}
+	if err := validateSynergies(input); err != nil {
+		return nil, nil, err
+	}
+
 	// We start by creating a MIP model.
 	model := mip.NewModel()
+	capacities := input.capacities()
+
+	// Create a map of ID to decision variables for each item, one for each
+	// knapsack.
+	itemVariables := make(map[string][]mip.Int, len(input.Items))
+	for _, item := range input.Items {
+		// Create a new integer decision variable for each item and knapsack,
+		// it is binary unless the item defines bounds.
+		itemVariables[item.ID] = make([]mip.Int, len(capacities))
+		for k := range capacities {
+			itemVariables[item.ID][k] = model.NewInt(0, int64(item.maxQuantity(input)))
+		}
+	}
+
+	// Items with bounds must be taken at least Min and at most Max times
+	// across all knapsacks, required items at least once. With several
+	// knapsacks, all other items are packed into at most one of them.
+	for _, item := range input.Items {
+		if minQuantity := item.minQuantity(); minQuantity > 0 {
+			lowerBound := model.NewConstraint(mip.GreaterThanOrEqual, float64(minQuantity))
+			for _, variable := range itemVariables[item.ID] {
+				lowerBound.NewTerm(1, variable)
+			}
+		}
+		if item.Max > 0 || len(capacities) > 1 {
+			upperBound := model.NewConstraint(mip.LessThanOrEqual, float64(item.maxQuantity(input)))
+			for _, variable := range itemVariables[item.ID] {
+				upperBound.NewTerm(1, variable)
+			}
+		}
+	}
 
-	// Create a map of ID to decision variables for each item in the knapsack.
-	itemVariables := make(map[string]mip.Bool, len(input.Items))
+	// The items taken of a category must not exceed its limit.
+	categoryConstraints := make(map[string]mip.Constraint, len(input.CategoryLimits))
 	for _, item := range input.Items {
-		// Create a new binary decision variable for each item in the knapsack.
-		itemVariables[item.ID] = model.NewBool()
+		limit, ok := input.CategoryLimits[item.Category]
+		if !ok {
+			continue
+		}
+		if _, ok := categoryConstraints[item.Category]; !ok {
+			categoryConstraints[item.Category] = model.NewConstraint(mip.LessThanOrEqual, float64(limit))
+		}
+		for _, variable := range itemVariables[item.ID] {
+			categoryConstraints[item.Category].NewTerm(1, variable)
+		}
 	}
 
-	// We want to maximize the value of the knapsack.
+	// Conflicting items must not be packed into the same knapsack. Items that
+	// can be taken several times need an indicator whether they are packed
+	// into the knapsack at all.
+	packed := make(map[string][]mip.Var, len(input.Items))
+	for _, item := range input.Items {
+		packed[item.ID] = make([]mip.Var, len(capacities))
+	}
+	indicator := func(item item, k int) mip.Var {
+		if packed[item.ID][k] != nil {
+			return packed[item.ID][k]
+		}
+		packed[item.ID][k] = itemVariables[item.ID][k]
+		if item.maxQuantity(input) > 1 {
+			// quantity <= max quantity * packed
+			isPacked := model.NewBool()
+			link := model.NewConstraint(mip.LessThanOrEqual, 0)
+			link.NewTerm(1, itemVariables[item.ID][k])
+			link.NewTerm(-float64(item.maxQuantity(input)), isPacked)
+			packed[item.ID][k] = isPacked
+		}
+		return packed[item.ID][k]
+	}
+	items := make(map[string]item, len(input.Items))
+	for _, item := range input.Items {
+		items[item.ID] = item
+	}
+	for _, conflict := range input.Conflicts {
+		for k := range capacities {
+			exclusion := model.NewConstraint(mip.LessThanOrEqual, 1)
+			exclusion.NewTerm(1, indicator(items[conflict[0]], k))
+			exclusion.NewTerm(1, indicator(items[conflict[1]], k))
+		}
+	}
+
+	// We want to maximize the profit of the knapsacks, i.e. the value of the
+	// items net of their cost. Items with a negative profit are only taken if
+	// they must be.
 	model.Objective().SetMaximize()
 
-	// This constraint ensures the weight capacity of the knapsack will not be
-	// exceeded.
-	capacityConstraint := model.NewConstraint(
-		mip.LessThanOrEqual,
-		input.WeightCapacity,
-	)
+	// The bonus of a synergy is earned if both of its items are taken, in any
+	// of the knapsacks.
+	for _, synergy := range input.Synergies {
+		earned := model.NewBool()
+		model.Objective().NewTerm(synergy.Bonus, earned)
+		for _, id := range []string{synergy.A, synergy.B} {
+			// earned <= number of times the item is taken
+			link := model.NewConstraint(mip.LessThanOrEqual, 0)
+			link.NewTerm(1, earned)
+			for _, variable := range itemVariables[id] {
+				link.NewTerm(-1, variable)
+			}
+		}
+	}
+
+	for k, capacity := range capacities {
+		// This constraint ensures the weight capacity of the knapsack will
+		// not be exceeded.
+		capacityConstraint := model.NewConstraint(
+			mip.LessThanOrEqual,
+			capacity,
+		)
 
-	// For each item, set the term in the objective function and in the
-	// constraint.
+		// The volume capacity is a second constraint on the same variables.
+		var volumeConstraint mip.Constraint
+		if input.VolumeCapacity > 0 {
+			volumeConstraint = model.NewConstraint(
+				mip.LessThanOrEqual,
+				input.VolumeCapacity,
+			)
+		}
+
+		// For each item, set the term in the objective function and in the
+		// constraints.
+		for _, item := range input.Items {
+			// Sets the profit of the item in the objective function.
+			model.Objective().NewTerm(item.Value-item.Cost, itemVariables[item.ID][k])
+
+			// Sets the weight of the item in the constraint.
+			capacityConstraint.NewTerm(item.Weight, itemVariables[item.ID][k])
+
+			// Sets the volume of the item in the constraint.
+			if volumeConstraint != nil {
+				volumeConstraint.NewTerm(item.Volume, itemVariables[item.ID][k])
+			}
+		}
+	}
+
+	return model, itemVariables, nil
+}
+
+// validateBounds returns an error if the bounds of an item are inconsistent or
+// if the minimum quantities of the items, including the required ones, exceed
+// the total weight or volume capacity or the limit of their category.
+func validateBounds(input input) error {
+	minWeight, minVolume := 0.0, 0.0
+	minCategory := map[string]int{}
+	// IDs of the items that must be taken.
+	taken := make([]string, 0)
+	for _, item := range input.Items {
+		if item.Min < 0 || item.Max < 0 {
+			return fmt.Errorf("item %q: min and max must not be negative", item.ID)
+		}
+		if item.Max > 0 && item.Min > item.Max {
+			return fmt.Errorf("item %q: min %d exceeds max %d", item.ID, item.Min, item.Max)
+		}
+		minQuantity := item.minQuantity()
+		if minQuantity > 0 {
+			taken = append(taken, item.ID)
+		}
+		minWeight += float64(minQuantity) * item.Weight
+		minVolume += float64(minQuantity) * item.Volume
+		minCategory[item.Category] += minQuantity
+	}
+
+	capacity := 0.0
+	for _, c := range input.capacities() {
+		capacity += c
+	}
+	if minWeight > capacity {
+		return fmt.Errorf(
+			"infeasible: the items %q that must be taken weigh %v which exceeds the weight capacity of %v",
+			taken, minWeight, capacity,
+		)
+	}
+	categories := make([]string, 0, len(input.CategoryLimits))
+	for category := range input.CategoryLimits {
+		categories = append(categories, category)
+	}
+	sort.Strings(categories)
+	for _, category := range categories {
+		limit := input.CategoryLimits[category]
+		if limit < 0 {
+			return fmt.Errorf("category %q: limit must not be negative", category)
+		}
+		if minCategory[category] > limit {
+			return fmt.Errorf(
+				"infeasible: the minimum quantities of the items of category %q sum up to %d which exceeds its limit of %d",
+				category, minCategory[category], limit,
+			)
+		}
+	}
+	volumeCapacity := input.VolumeCapacity * float64(len(input.capacities()))
+	if input.VolumeCapacity > 0 && minVolume > volumeCapacity {
+		return fmt.Errorf(
+			"infeasible: the items %q that must be taken take up a volume of %v which exceeds "+
+				"the volume capacity of %v",
+			taken, minVolume, volumeCapacity,
+		)
+	}
+
+	return nil
+}
+
+// validateConflicts returns an error if a conflict refers to an unknown item,
+// an item conflicts with itself or, with a single knapsack, both items of a
+// conflict must be taken.
+func validateConflicts(input input) error {
+	items := make(map[string]item, len(input.Items))
 	for _, item := range input.Items {
-		// Sets the value of the item in the objective function.
-		model.Objective().NewTerm(item.Value, itemVariables[item.ID])
+		items[item.ID] = item
+	}
+	for _, conflict := range input.Conflicts {
+		for _, id := range conflict {
+			if _, ok := items[id]; !ok {
+				return fmt.Errorf("conflict %v: unknown item %q", conflict, id)
+			}
+		}
+		if conflict[0] == conflict[1] {
+			return fmt.Errorf("conflict %v: item %q conflicts with itself", conflict, conflict[0])
+		}
+		if len(input.capacities()) == 1 &&
+			items[conflict[0]].minQuantity() > 0 && items[conflict[1]].minQuantity() > 0 {
+			return fmt.Errorf(
+				"infeasible: the conflicting items %q and %q must both be taken", conflict[0], conflict[1],
+			)
+		}
+	}
 
-		// Sets the weight of the item in the constraint.
-		capacityConstraint.NewTerm(item.Weight, itemVariables[item.ID])
+	return nil
+}
+
+// validateSynergies returns an error if a synergy refers to an unknown item, an
+// item has a synergy with itself or the bonus is negative.
+func validateSynergies(input input) error {
+	items := make(map[string]bool, len(input.Items))
+	for _, item := range input.Items {
+		items[item.ID] = true
+	}
+	for _, synergy := range input.Synergies {
+		for _, id := range []string{synergy.A, synergy.B} {
+			if !items[id] {
+				return fmt.Errorf("synergy %q and %q: unknown item %q", synergy.A, synergy.B, id)
+			}
+		}
+		if synergy.A == synergy.B {
+			return fmt.Errorf("synergy %q and %q: item %q has a synergy with itself", synergy.A, synergy.B, synergy.A)
+		}
+		if synergy.Bonus < 0 {
+			return fmt.Errorf("synergy %q and %q: bonus must not be negative", synergy.A, synergy.B)
+		}
 	}
 
-	return model, itemVariables
+	return nil
 }
 
-// format the solution from the solver into the desired output format.
-func format(input input, solverSolution mip.Solution, itemVariables map[string]mip.Bool) solution {
+// format the solution from the solver into the desired output format. With
+// several knapsacks, an item with bounds that is split across knapsacks is
+// reported once per knapsack.
+func format(input input, solverSolution mip.Solution, itemVariables map[string][]mip.Int) solution {
 	if !solverSolution.IsOptimal() && !solverSolution.IsSubOptimal() {
 		return solution{}
 	}
 
 	items := make([]item, 0)
+	unselectedItems := make([]item, 0)
+	selectedIDs := make(map[string]bool, len(input.Items))
+	remainingCapacity := 0.0
+	for _, capacity := range input.capacities() {
+		remainingCapacity += capacity
+	}
 	for _, item := range input.Items {
-		if solverSolution.Value(itemVariables[item.ID]) > 0.9 {
+		selected := false
+		for k, variable := range itemVariables[item.ID] {
+			quantity := int(math.Round(solverSolution.Value(variable)))
+			if quantity < 1 {
+				continue
+			}
+			selected = true
+			remainingCapacity -= float64(quantity) * item.Weight
+			if item.isBounded() {
+				item.Quantity = quantity
+			}
+			if len(input.Capacities) > 0 {
+				knapsackID := k
+				item.KnapsackID = &knapsackID
+			}
 			items = append(items, item)
 		}
+		if !selected {
+			unselectedItems = append(unselectedItems, item)
+		}
+		selectedIDs[item.ID] = selected
+	}
+
+	synergies := make([]synergy, 0)
+	for _, synergy := range input.Synergies {
+		if selectedIDs[synergy.A] && selectedIDs[synergy.B] {
+			synergies = append(synergies, synergy)
+		}
 	}
 
 	return solution{
-		Items: items,
+		Items:             items,
+		UnselectedItems:   unselectedItems,
+		RemainingCapacity: remainingCapacity,
+		Synergies:         synergies,
 	}
 }
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/nextmv-io/nextroute"
+	"github.com/nextmv-io/nextroute/schema"
+)
+
+// The types of stops on routes with backhauls. Deliveries unload outbound
+// freight, pickups load the backhaul freight that is brought back.
+const (
+	delivery = "delivery"
+	pickup   = "pickup"
+)
+
+// stopType returns the type of the stop in its custom data, delivery or
+// pickup, or an empty string if it has none.
+func stopType(stop schema.Stop) (string, error) {
+	if _, ok := stop.CustomData.(map[string]any); !ok {
+		return "", nil
+	}
+	customData, err := schema.ConvertCustomData[struct {
+		Type string `json:"type"`
+	}](stop.CustomData)
+	if err != nil {
+		return "", fmt.Errorf("stop %q: type: %w", stop.ID, err)
+	}
+	switch customData.Type {
+	case "", delivery, pickup:
+		return customData.Type, nil
+	default:
+		return "", fmt.Errorf("stop %q: type must be %q or %q, it is %q", stop.ID, delivery, pickup, customData.Type)
+	}
+}
+
+// withBackhauls returns the input in which the quantities of the deliveries
+// and pickups are split into an outbound and a backhaul resource, each limited
+// by the full capacity of the vehicles. The load of both only grows along a
+// route, so the outbound load is all the freight a vehicle leaves with and the
+// backhaul load is all the freight it returns with. It also returns the stop
+// types, indexed like the stops, or nil if no stop has a type.
+func withBackhauls(input schema.Input) (schema.Input, []string, error) {
+	types := make([]string, len(input.Stops))
+	found := false
+	for i, stop := range input.Stops {
+		t, err := stopType(stop)
+		if err != nil {
+			return schema.Input{}, nil, err
+		}
+		types[i] = t
+		found = found || t != ""
+	}
+	if !found {
+		return input, nil, nil
+	}
+
+	var defaults schema.Defaults
+	if input.Defaults != nil {
+		defaults = *input.Defaults
+	}
+	var stopDefaults schema.StopDefaults
+	if defaults.Stops != nil {
+		stopDefaults = *defaults.Stops
+	}
+	var vehicleDefaults schema.VehicleDefaults
+	if defaults.Vehicles != nil {
+		vehicleDefaults = *defaults.Vehicles
+	}
+
+	stops := make([]schema.Stop, len(input.Stops))
+	copy(stops, input.Stops)
+	for i, stop := range stops {
+		quantity := stop.Quantity
+		if quantity == nil {
+			quantity = stopDefaults.Quantity
+		}
+		if quantity == nil {
+			continue
+		}
+		if types[i] == "" {
+			return schema.Input{}, nil, fmt.Errorf("stop %q: stops with a quantity need a type with backhauls", stop.ID)
+		}
+		amount, ok := quantity.(float64)
+		if !ok {
+			return schema.Input{}, nil, fmt.Errorf("stop %q: quantity must be a number with backhauls", stop.ID)
+		}
+		// A negative quantity adds to the load of the vehicle.
+		resource := "outbound"
+		if types[i] == pickup {
+			resource = "backhaul"
+		}
+		stops[i].Quantity = map[string]any{resource: -math.Abs(amount)}
+	}
+
+	vehicles := make([]schema.Vehicle, len(input.Vehicles))
+	copy(vehicles, input.Vehicles)
+	for i, vehicle := range vehicles {
+		capacity := vehicle.Capacity
+		if capacity == nil {
+			capacity = vehicleDefaults.Capacity
+		}
+		if capacity == nil {
+			continue
+		}
+		amount, ok := capacity.(float64)
+		if !ok {
+			return schema.Input{}, nil, fmt.Errorf("vehicle %q: capacity must be a number with backhauls", vehicle.ID)
+		}
+		vehicles[i].Capacity = map[string]any{"outbound": amount, "backhaul": amount}
+	}
+
+	stopDefaults.Quantity = nil
+	vehicleDefaults.Capacity = nil
+	defaults.Stops = &stopDefaults
+	defaults.Vehicles = &vehicleDefaults
+	input.Defaults = &defaults
+	input.Stops = stops
+	input.Vehicles = vehicles
+
+	return input, types, nil
+}
+
+// backhaulConstraint requires all deliveries on a route to precede all
+// pickups.
+type backhaulConstraint struct {
+	// pickups and deliveries are indexed by the index of the model stop.
+	pickups    []bool
+	deliveries []bool
+}
+
+func newBackhaulConstraint(model nextroute.Model, types []string) (nextroute.ModelConstraint, error) {
+	constraint := backhaulConstraint{
+		pickups:    make([]bool, model.NumberOfStops()),
+		deliveries: make([]bool, model.NumberOfStops()),
+	}
+	// The model stops start with the stops of the input, in their order.
+	for i, t := range types {
+		stop, err := model.Stop(i)
+		if err != nil {
+			return nil, err
+		}
+		constraint.pickups[stop.Index()] = t == pickup
+		constraint.deliveries[stop.Index()] = t == delivery
+	}
+
+	return constraint, nil
+}
+
+func (c backhaulConstraint) EstimateIsViolated(
+	move nextroute.SolutionMoveStops,
+) (bool, nextroute.StopPositionsHint) {
+	_, route := routeAfterMove(move)
+	picked := false
+	for _, stop := range route {
+		index := stop.ModelStop().Index()
+		if picked && c.deliveries[index] {
+			return true, nextroute.NoPositionsHint()
+		}
+		picked = picked || c.pickups[index]
+	}
+
+	return false, nextroute.NoPositionsHint()
+}
+
+func (c backhaulConstraint) String() string {
+	return "backhaul"
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"math"
+
+	"github.com/nextmv-io/nextroute"
+)
+
+// balanceObjective penalizes the spread between the longest and the shortest
+// route duration of the vehicles, in seconds. Vehicles that are not used
+// count with the duration of their empty route, so the longest route is
+// shortened by using more vehicles.
+type balanceObjective struct{}
+
+// balanceStatistics reports the longest and the shortest route duration of
+// the vehicles and their spread, in seconds.
+type balanceStatistics struct {
+	MaxDuration int `json:"max_duration"`
+	MinDuration int `json:"min_duration"`
+	Spread      int `json:"spread"`
+}
+
+func (o balanceObjective) EstimateDeltaValue(move nextroute.SolutionMoveStops) float64 {
+	vehicle, route := routeAfterMove(move)
+
+	// Propagate the times along the route, waiting and service included.
+	vehicleType := vehicle.ModelVehicle().VehicleType()
+	end := vehicle.First().EndValue()
+	for i := 1; i < len(route); i++ {
+		_, _, _, end = vehicleType.TemporalValues(end, route[i-1].ModelStop(), route[i].ModelStop())
+	}
+
+	solution := vehicle.First().Solution()
+	minimum, maximum := durationRange(solution, vehicle, end-vehicle.StartValue())
+	minimumBefore, maximumBefore := durationRange(solution, nil, 0)
+
+	return (maximum - minimum) - (maximumBefore - minimumBefore)
+}
+
+func (o balanceObjective) Value(solution nextroute.Solution) float64 {
+	minimum, maximum := durationRange(solution, nil, 0)
+	return maximum - minimum
+}
+
+func (o balanceObjective) String() string {
+	return "balance"
+}
+
+// durationRange returns the shortest and the longest route duration of the
+// vehicles. If a vehicle is given, its duration is replaced by the given one.
+func durationRange(
+	solution nextroute.Solution,
+	vehicle nextroute.SolutionVehicle,
+	duration float64,
+) (minimum, maximum float64) {
+	minimum, maximum = math.Inf(1), math.Inf(-1)
+	for _, v := range solution.Vehicles() {
+		d := v.DurationValue()
+		if vehicle != nil && v.Index() == vehicle.Index() {
+			d = duration
+		}
+		minimum = math.Min(minimum, d)
+		maximum = math.Max(maximum, d)
+	}
+	if len(solution.Vehicles()) == 0 {
+		return 0, 0
+	}
+
+	return minimum, maximum
+}
+
+// newBalanceStatistics returns the balance of the route durations of the
+// solution.
+func newBalanceStatistics(solution nextroute.Solution) *balanceStatistics {
+	minimum, maximum := durationRange(solution, nil, 0)
+	return &balanceStatistics{
+		MaxDuration: int(maximum),
+		MinDuration: int(minimum),
+		Spread:      int(maximum - minimum),
+	}
+}
@@ -0,0 +1,278 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/nextmv-io/nextroute"
+	"github.com/nextmv-io/nextroute/factory"
+	"github.com/nextmv-io/nextroute/schema"
+)
+
+// breakRule requires a vehicle to take a break of BreakDuration seconds at a
+// stop before it drives more than MaxDriveBeforeBreak seconds since its start
+// or its last break.
+type breakRule struct {
+	MaxDriveBeforeBreak int `json:"max_drive_before_break"`
+	BreakDuration       int `json:"break_duration"`
+
+	// latestEnd is the time by which the vehicle must end its route, from
+	// its end time and its maximum duration, nil if it has neither.
+	latestEnd *time.Time
+}
+
+// routeBreak is a break taken on the way to a stop, reported in the custom
+// data of the stop in the route of the output.
+type routeBreak struct {
+	Start    time.Time `json:"start"`
+	End      time.Time `json:"end"`
+	Duration int       `json:"duration"`
+}
+
+// vehicleBreakRule returns the break rule in the custom data of the vehicle,
+// nil if it has none.
+func vehicleBreakRule(vehicle schema.Vehicle) (*breakRule, error) {
+	if _, ok := vehicle.CustomData.(map[string]any); !ok {
+		return nil, nil
+	}
+	rule, err := schema.ConvertCustomData[breakRule](vehicle.CustomData)
+	if err != nil {
+		return nil, fmt.Errorf("vehicle %q: break rule: %w", vehicle.ID, err)
+	}
+	if rule.MaxDriveBeforeBreak == 0 && rule.BreakDuration == 0 {
+		return nil, nil
+	}
+	if rule.MaxDriveBeforeBreak <= 0 || rule.BreakDuration <= 0 {
+		return nil, fmt.Errorf(
+			"vehicle %q: max_drive_before_break and break_duration must both be positive", vehicle.ID,
+		)
+	}
+
+	return &rule, nil
+}
+
+// latestEnd returns the time by which the vehicle must end its route, the
+// earlier of its end time and its start plus its maximum duration, like the
+// factory constrains it. A limit whose constraint is disabled is ignored. It
+// returns nil if the vehicle has no limit.
+func latestEnd(vehicle nextroute.ModelVehicle, inputVehicle schema.Vehicle, options factory.Options) *time.Time {
+	var end *time.Time
+	if inputVehicle.EndTime != nil && !options.Constraints.Disable.VehicleEndTime {
+		end = inputVehicle.EndTime
+	}
+	if inputVehicle.MaxDuration != nil && !options.Constraints.Disable.MaximumDuration {
+		maxEnd := vehicle.Start().Add(time.Duration(*inputVehicle.MaxDuration) * time.Second)
+		if end == nil || maxEnd.Before(*end) {
+			end = &maxEnd
+		}
+	}
+
+	return end
+}
+
+// breakRules returns the break rule of every model vehicle, indexed by the
+// index of the vehicle, and whether any vehicle has one.
+func breakRules(model nextroute.Model, options factory.Options) ([]*breakRule, bool, error) {
+	rules := make([]*breakRule, len(model.Vehicles()))
+	found := false
+	for _, vehicle := range model.Vehicles() {
+		inputVehicle, ok := vehicle.Data().(schema.Vehicle)
+		if !ok {
+			continue
+		}
+		rule, err := vehicleBreakRule(inputVehicle)
+		if err != nil {
+			return nil, false, err
+		}
+		if rule != nil {
+			rule.latestEnd = latestEnd(vehicle, inputVehicle, options)
+		}
+		rules[vehicle.Index()] = rule
+		found = found || rule != nil
+	}
+
+	return rules, found, nil
+}
+
+// timedStop holds the times of a stop on a route with breaks, as model values.
+// If a break is taken on the way to the stop, it lasts from breakStart to
+// breakEnd, otherwise both are zero.
+type timedStop struct {
+	stop                     nextroute.ModelStop
+	arrival, start, end      float64
+	breakStart, breakEnd     float64
+	travelDuration, waitTime float64
+}
+
+// breakTimeline propagates the times along the route of the vehicle, start
+// and end included, taking a break at a stop whenever driving the next leg
+// would exceed the maximum driving time since the last break. Waiting does not
+// count as a break. A single leg longer than the maximum driving time is
+// driven without a break, as breaks are only taken at stops.
+func breakTimeline(vehicle nextroute.SolutionVehicle, route []nextroute.SolutionStop, rule breakRule) []timedStop {
+	model := vehicle.ModelVehicle().Model()
+	vehicleType := vehicle.ModelVehicle().VehicleType()
+	maxDrive := model.DurationToValue(time.Duration(rule.MaxDriveBeforeBreak) * time.Second)
+	breakDuration := model.DurationToValue(time.Duration(rule.BreakDuration) * time.Second)
+
+	first := route[0]
+	timeline := make([]timedStop, len(route))
+	timeline[0] = timedStop{
+		stop:    first.ModelStop(),
+		arrival: first.ArrivalValue(),
+		start:   first.StartValue(),
+		end:     first.EndValue(),
+	}
+	drive := 0.0
+	departure := first.EndValue()
+	for i := 1; i < len(route); i++ {
+		from, to := route[i-1].ModelStop(), route[i].ModelStop()
+		timed := timedStop{stop: to}
+		travel, arrival, start, end := vehicleType.TemporalValues(departure, from, to)
+		if drive > 0 && drive+travel > maxDrive {
+			timed.breakStart, timed.breakEnd = departure, departure+breakDuration
+			travel, arrival, start, end = vehicleType.TemporalValues(timed.breakEnd, from, to)
+			drive = 0
+		}
+		drive += travel
+		timed.arrival, timed.start, timed.end = arrival, start, end
+		timed.travelDuration, timed.waitTime = travel, start-arrival
+		timeline[i] = timed
+		departure = end
+	}
+
+	return timeline
+}
+
+// breakConstraint rejects moves after which a vehicle with a break rule
+// starts serving a stop outside of its time windows, or ends its route after
+// its end time or its maximum duration, because of its breaks. The constraints
+// of the model do not know about the breaks, so they check the times without
+// them.
+type breakConstraint struct {
+	// rules is indexed by the index of the model vehicle.
+	rules []*breakRule
+}
+
+func (c breakConstraint) EstimateIsViolated(
+	move nextroute.SolutionMoveStops,
+) (bool, nextroute.StopPositionsHint) {
+	vehicle, route := routeAfterMove(move)
+	rule := c.rules[vehicle.ModelVehicle().Index()]
+	if rule == nil {
+		return false, nextroute.NoPositionsHint()
+	}
+
+	model := vehicle.ModelVehicle().Model()
+	timeline := breakTimeline(vehicle, route, *rule)
+	for _, timed := range timeline {
+		if !withinWindows(timed.stop, model.ValueToTime(timed.start)) {
+			return true, nextroute.NoPositionsHint()
+		}
+	}
+	last := timeline[len(timeline)-1]
+	if rule.latestEnd != nil && model.ValueToTime(last.end).After(*rule.latestEnd) {
+		return true, nextroute.NoPositionsHint()
+	}
+
+	return false, nextroute.NoPositionsHint()
+}
+
+func (c breakConstraint) String() string {
+	return "breaks"
+}
+
+// withinWindows returns whether the given start is within one of the time
+// windows of the stop. Stops without time windows can start at any time.
+func withinWindows(stop nextroute.ModelStop, start time.Time) bool {
+	windows := stop.Windows()
+	if len(windows) == 0 {
+		return true
+	}
+	for _, window := range windows {
+		if !start.Before(window[0]) && !start.After(window[1]) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// addBreaks adds the constraint on the breaks of the vehicles to the model,
+// if any vehicle has a break rule. It returns the break rules of the vehicles.
+func addBreaks(model nextroute.Model, options factory.Options) ([]*breakRule, error) {
+	rules, found, err := breakRules(model, options)
+	if err != nil || !found {
+		return nil, err
+	}
+
+	return rules, model.AddConstraint(breakConstraint{rules: rules})
+}
+
+// applyBreaks shifts the times of the routes in the last solution of the
+// output and in the statistics of the vehicles by the breaks of the vehicles,
+// and reports every break in the custom data of the stop it is taken on the
+// way to.
+func applyBreaks(
+	output *schema.SolutionOutput,
+	vehicles []vehicleStatistics,
+	solution nextroute.Solution,
+	rules []*breakRule,
+) {
+	model := solution.Model()
+	for i, vehicle := range solution.Vehicles() {
+		rule := rules[vehicle.ModelVehicle().Index()]
+		if rule == nil {
+			continue
+		}
+		timeline := breakTimeline(vehicle, vehicle.SolutionStops(), *rule)
+		location := vehicle.ModelVehicle().Start().Location()
+		toTime := func(value float64) *time.Time {
+			t := model.ValueToTime(value).In(location)
+			return &t
+		}
+		timedStops := make(map[string]timedStop, len(timeline))
+		for _, timed := range timeline {
+			timedStops[timed.stop.ID()] = timed
+		}
+
+		outputVehicle := &output.Vehicles[i]
+		cumulativeTravel := 0
+		for j, stop := range outputVehicle.Route {
+			timed := timedStops[stop.Stop.ID]
+			travel := seconds(model, timed.travelDuration)
+			cumulativeTravel += travel
+			outputVehicle.Route[j].TravelDuration = travel
+			outputVehicle.Route[j].CumulativeTravelDuration = cumulativeTravel
+			outputVehicle.Route[j].WaitingDuration = seconds(model, timed.waitTime)
+			if stop.ArrivalTime != nil {
+				outputVehicle.Route[j].ArrivalTime = toTime(timed.arrival)
+				outputVehicle.Route[j].StartTime = toTime(timed.start)
+				outputVehicle.Route[j].EndTime = toTime(timed.end)
+			}
+			if timed.breakEnd > timed.breakStart {
+				outputVehicle.Route[j].CustomData = map[string]any{
+					"break": routeBreak{
+						Start:    *toTime(timed.breakStart),
+						End:      *toTime(timed.breakEnd),
+						Duration: rule.BreakDuration,
+					},
+				}
+			}
+		}
+
+		last := timeline[len(timeline)-1]
+		duration := seconds(model, last.end-timeline[0].start)
+		outputVehicle.RouteDuration = duration
+		outputVehicle.RouteTravelDuration = cumulativeTravel
+		vehicles[i].Duration = duration
+		if vehicles[i].End != nil {
+			vehicles[i].End = toTime(last.end)
+		}
+	}
+}
+
+// seconds converts a duration given as a model value to seconds.
+func seconds(model nextroute.Model, value float64) int {
+	return int((time.Duration(value) * model.DurationUnit()).Seconds())
+}
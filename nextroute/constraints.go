@@ -0,0 +1,185 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/nextmv-io/nextroute"
+	"github.com/nextmv-io/nextroute/schema"
+)
+
+// customConstraints is the registry of the constraints that can be added to
+// the model by name, on top of the ones created from the input by the
+// factory. They read their data from the custom data of the stops and
+// vehicles.
+var customConstraints = map[string]func(nextroute.Model) (nextroute.ModelConstraint, error){
+	"refrigerated":   newRefrigeratedConstraint,
+	"latest_arrival": newLatestArrivalConstraint,
+	"first_stop":     newFirstStopConstraint,
+}
+
+// addCustomConstraints adds the constraints of the registry with the given
+// names to the model.
+func addCustomConstraints(model nextroute.Model, names []string) error {
+	for _, name := range names {
+		newConstraint, ok := customConstraints[name]
+		if !ok {
+			known := make([]string, 0, len(customConstraints))
+			for name := range customConstraints {
+				known = append(known, name)
+			}
+			sort.Strings(known)
+			return fmt.Errorf("unknown custom constraint %q, want one of %q", name, known)
+		}
+		constraint, err := newConstraint(model)
+		if err != nil {
+			return fmt.Errorf("custom constraint %q: %w", name, err)
+		}
+		if err := model.AddConstraint(constraint); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// refrigeratedConstraint only allows stops that are marked as refrigerated in
+// their custom data to be served by vehicles that are marked as refrigerated
+// as well, e.g. {"refrigerated": true}.
+type refrigeratedConstraint struct {
+	// stops and vehicles are indexed by the index of the model stop and
+	// vehicle respectively.
+	stops    []bool
+	vehicles []bool
+}
+
+func newRefrigeratedConstraint(model nextroute.Model) (nextroute.ModelConstraint, error) {
+	constraint := refrigeratedConstraint{
+		stops:    make([]bool, model.NumberOfStops()),
+		vehicles: make([]bool, len(model.Vehicles())),
+	}
+	for _, stop := range model.Stops() {
+		constraint.stops[stop.Index()], _ = stopCustomData(stop)["refrigerated"].(bool)
+	}
+	for _, vehicle := range model.Vehicles() {
+		constraint.vehicles[vehicle.Index()], _ = vehicleCustomData(vehicle)["refrigerated"].(bool)
+	}
+
+	return constraint, nil
+}
+
+func (c refrigeratedConstraint) EstimateIsViolated(
+	move nextroute.SolutionMoveStops,
+) (bool, nextroute.StopPositionsHint) {
+	vehicle := move.Vehicle()
+	if vehicle == nil {
+		vehicle = move.Previous().Vehicle()
+	}
+	if c.vehicles[vehicle.ModelVehicle().Index()] {
+		return false, nextroute.NoPositionsHint()
+	}
+
+	for _, position := range move.StopPositions() {
+		if c.stops[position.Stop().ModelStop().Index()] {
+			return true, nextroute.SkipVehiclePositionsHint()
+		}
+	}
+
+	return false, nextroute.NoPositionsHint()
+}
+
+func (c refrigeratedConstraint) String() string {
+	return "refrigerated"
+}
+
+// newLatestArrivalConstraint returns a constraint that requires vehicles to
+// arrive at a stop no later than the latest_arrival in its custom data, e.g.
+// {"latest_arrival": "2023-01-01T12:00:00Z"}. Unlike a start time window, it
+// does not restrict when the service starts after the arrival.
+func newLatestArrivalConstraint(model nextroute.Model) (nextroute.ModelConstraint, error) {
+	latest := nextroute.NewStopTimeExpression("latest_arrival", model.MaxTime())
+	for _, stop := range model.Stops() {
+		value, ok := stopCustomData(stop)["latest_arrival"]
+		if !ok {
+			continue
+		}
+		text, ok := value.(string)
+		if !ok {
+			return nil, fmt.Errorf("stop %q: latest_arrival must be a string", stop.ID())
+		}
+		t, err := time.Parse(time.RFC3339, text)
+		if err != nil {
+			return nil, fmt.Errorf("stop %q: latest_arrival: %w", stop.ID(), err)
+		}
+		latest.SetTime(stop, t)
+	}
+
+	return nextroute.NewLatestArrival(latest)
+}
+
+// firstStopConstraint requires stops that are marked as first in their custom
+// data, e.g. {"first": true}, to be the first stop on the route of their
+// vehicle.
+type firstStopConstraint struct {
+	// stops is indexed by the index of the model stop.
+	stops []bool
+}
+
+func newFirstStopConstraint(model nextroute.Model) (nextroute.ModelConstraint, error) {
+	constraint := firstStopConstraint{
+		stops: make([]bool, model.NumberOfStops()),
+	}
+	for _, stop := range model.Stops() {
+		constraint.stops[stop.Index()], _ = stopCustomData(stop)["first"].(bool)
+	}
+
+	return constraint, nil
+}
+
+func (c firstStopConstraint) EstimateIsViolated(
+	move nextroute.SolutionMoveStops,
+) (bool, nextroute.StopPositionsHint) {
+	for _, position := range move.StopPositions() {
+		// A first stop must directly follow the start of the vehicle.
+		previous := position.Previous()
+		if c.stops[position.Stop().ModelStop().Index()] && !(previous.IsPlanned() && previous.IsFirst()) {
+			return true, nextroute.NoPositionsHint()
+		}
+
+		// No stop may be inserted in front of a planned first stop.
+		next := position.Next()
+		if next.IsPlanned() && c.stops[next.ModelStop().Index()] {
+			return true, nextroute.NoPositionsHint()
+		}
+	}
+
+	return false, nextroute.NoPositionsHint()
+}
+
+func (c firstStopConstraint) String() string {
+	return "first_stop"
+}
+
+// stopCustomData returns the custom data of the stop, if it is an object.
+func stopCustomData(stop nextroute.ModelStop) map[string]any {
+	inputStop, ok := stop.Data().(schema.Stop)
+	if !ok {
+		return nil
+	}
+	customData, _ := inputStop.CustomData.(map[string]any)
+
+	return customData
+}
+
+// vehicleCustomData returns the custom data of the vehicle, if it is an
+// object.
+func vehicleCustomData(vehicle nextroute.ModelVehicle) map[string]any {
+	inputVehicle, ok := vehicle.Data().(schema.Vehicle)
+	if !ok {
+		return nil
+	}
+	customData, _ := inputVehicle.CustomData.(map[string]any)
+
+	return customData
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"github.com/nextmv-io/nextroute"
+	"github.com/nextmv-io/nextroute/common"
+)
+
+// crossingsObjective penalizes routes that intersect themselves. Crossings are
+// detected geometrically from the locations of the stops.
+type crossingsObjective struct{}
+
+// crossingsStatistics reports the number of route self-intersections of the
+// first and the last solution found by the solver.
+type crossingsStatistics struct {
+	Before int `json:"before"`
+	After  int `json:"after"`
+}
+
+func (o crossingsObjective) EstimateDeltaValue(move nextroute.SolutionMoveStops) float64 {
+	vehicle, route := routeAfterMove(move)
+
+	before := make([]common.Location, 0, vehicle.NumberOfStops()+2)
+	for _, stop := range vehicle.SolutionStops() {
+		before = appendLocation(before, stop)
+	}
+	after := make([]common.Location, 0, len(route))
+	for _, stop := range route {
+		after = appendLocation(after, stop)
+	}
+
+	return float64(countCrossings(after) - countCrossings(before))
+}
+
+func (o crossingsObjective) Value(solution nextroute.Solution) float64 {
+	return float64(solutionCrossings(solution))
+}
+
+func (o crossingsObjective) String() string {
+	return "crossings"
+}
+
+// solutionCrossings returns the number of self-intersections of all routes in
+// the solution.
+func solutionCrossings(solution nextroute.Solution) int {
+	crossings := 0
+	for _, vehicle := range solution.Vehicles() {
+		locations := make([]common.Location, 0, vehicle.NumberOfStops()+2)
+		for _, stop := range vehicle.SolutionStops() {
+			locations = appendLocation(locations, stop)
+		}
+		crossings += countCrossings(locations)
+	}
+
+	return crossings
+}
+
+// routeAfterMove returns the vehicle of the move and its stops, including the
+// start and the end, as they would be if the move were executed.
+func routeAfterMove(move nextroute.SolutionMoveStops) (nextroute.SolutionVehicle, []nextroute.SolutionStop) {
+	vehicle := move.Vehicle()
+	if vehicle == nil {
+		vehicle = move.Previous().Vehicle()
+	}
+
+	// The stops of the move are inserted after the planned stop which is
+	// their previous stop. Consecutive stops of the move form a chain.
+	inserted := map[int][]nextroute.SolutionStop{}
+	anchor := -1
+	for _, position := range move.StopPositions() {
+		if position.Previous().IsPlanned() {
+			anchor = position.Previous().Index()
+		}
+		inserted[anchor] = append(inserted[anchor], position.Stop())
+	}
+
+	route := make([]nextroute.SolutionStop, 0, vehicle.NumberOfStops()+2+len(move.StopPositions()))
+	for _, stop := range vehicle.SolutionStops() {
+		route = append(route, stop)
+		route = append(route, inserted[stop.Index()]...)
+	}
+
+	return vehicle, route
+}
+
+// appendLocation appends the location of the stop, if it has a valid one.
+// Vehicles without a start or end location have stops without location.
+func appendLocation(locations []common.Location, stop nextroute.SolutionStop) []common.Location {
+	location := stop.ModelStop().Location()
+	if !location.IsValid() {
+		return locations
+	}
+
+	return append(locations, location)
+}
+
+// countCrossings returns the number of pairs of segments of the route given by
+// the locations that properly intersect.
+func countCrossings(locations []common.Location) int {
+	crossings := 0
+	for i := 0; i+1 < len(locations); i++ {
+		for j := i + 2; j+1 < len(locations); j++ {
+			if intersect(locations[i], locations[i+1], locations[j], locations[j+1]) {
+				crossings++
+			}
+		}
+	}
+
+	return crossings
+}
+
+// intersect returns true if the segments p1-p2 and q1-q2 properly intersect.
+// Segments that only touch, e.g. by sharing an endpoint, do not intersect.
+func intersect(p1, p2, q1, q2 common.Location) bool {
+	d1 := orientation(q1, q2, p1)
+	d2 := orientation(q1, q2, p2)
+	d3 := orientation(p1, p2, q1)
+	d4 := orientation(p1, p2, q2)
+
+	return d1*d2 < 0 && d3*d4 < 0
+}
+
+// orientation returns the cross product of the vectors a-b and a-c. It is
+// positive if c is left of a-b, negative if it is right of it and zero if the
+// three locations are collinear.
+func orientation(a, b, c common.Location) float64 {
+	return (b.Longitude()-a.Longitude())*(c.Latitude()-a.Latitude()) -
+		(b.Latitude()-a.Latitude())*(c.Longitude()-a.Longitude())
+}
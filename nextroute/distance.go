@@ -0,0 +1,83 @@
+package main
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/nextmv-io/nextroute/schema"
+)
+
+// Distance metrics between locations. Haversine is the great-circle distance
+// used by nextroute by default.
+const (
+	haversineMetric = "haversine"
+	manhattanMetric = "manhattan"
+	euclideanMetric = "euclidean"
+)
+
+// earthRadius is the mean radius of the earth in meters, as used by the
+// haversine distance of nextroute.
+const earthRadius = 6371 * 1000
+
+// withDistanceMetric returns the input with a distance matrix computed with the
+// given metric, unless the input already defines one. Travel durations follow
+// from the distances and the speed of the vehicles.
+func withDistanceMetric(input schema.Input, metric string) (schema.Input, error) {
+	var distance func(from, to schema.Location) float64
+	switch metric {
+	case haversineMetric:
+		return input, nil
+	case manhattanMetric:
+		distance = func(from, to schema.Location) float64 {
+			dx, dy := project(from, to)
+			return math.Abs(dx) + math.Abs(dy)
+		}
+	case euclideanMetric:
+		distance = func(from, to schema.Location) float64 {
+			return math.Hypot(project(from, to))
+		}
+	default:
+		return schema.Input{}, fmt.Errorf(
+			"unknown distance metric %q, want one of %q, %q or %q",
+			metric, haversineMetric, manhattanMetric, euclideanMetric,
+		)
+	}
+
+	if input.DistanceMatrix != nil {
+		return input, nil
+	}
+	if input.AlternateStops != nil {
+		return schema.Input{}, fmt.Errorf("distance metric %q is not supported with alternate stops", metric)
+	}
+
+	// Vehicles without a start or end location travel to and from it at no
+	// cost.
+	locations := matrixLocations(input)
+	matrix := make([][]float64, len(locations))
+	for i, from := range locations {
+		matrix[i] = make([]float64, len(locations))
+		if from == nil {
+			continue
+		}
+		for j, to := range locations {
+			if to == nil {
+				continue
+			}
+			matrix[i][j] = distance(*from, *to)
+		}
+	}
+	input.DistanceMatrix = &matrix
+
+	return input, nil
+}
+
+// project returns the east-west and north-south distance in meters between
+// the locations, using an equirectangular projection at their mean latitude.
+// It is accurate for the distances within a city.
+func project(from, to schema.Location) (dx, dy float64) {
+	latitude := (from.Lat + to.Lat) / 2 * math.Pi / 180
+	dx = (to.Lon - from.Lon) * math.Pi / 180 * math.Cos(latitude) * earthRadius
+	dy = (to.Lat - from.Lat) * math.Pi / 180 * earthRadius
+
+	return dx, dy
+}
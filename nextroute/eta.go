@@ -0,0 +1,66 @@
+package main
+
+import (
+	"math"
+	"time"
+
+	"github.com/nextmv-io/nextroute"
+	"github.com/nextmv-io/nextroute/schema"
+)
+
+// etaBand is the range in which the arrival at a stop is expected, given the
+// variability of the service durations of the stops before it on the route.
+type etaBand struct {
+	Low    time.Time `json:"low"`
+	High   time.Time `json:"high"`
+	StdDev float64   `json:"std_dev"`
+}
+
+// etaBands returns the ETA band of every planned stop. The service duration
+// standard deviation of a stop is read from its custom data as
+// service_duration_std_dev (in seconds). The variances of the stops before a
+// stop on the route are summed up and the band spans the given number of
+// standard deviations around the arrival time.
+func etaBands(solution nextroute.Solution, deviations float64) map[string]etaBand {
+	bands := map[string]etaBand{}
+	for _, vehicle := range solution.Vehicles() {
+		variance := 0.0
+		for _, stop := range vehicle.SolutionStops() {
+			if stop.IsFirst() || stop.IsLast() {
+				continue
+			}
+
+			stdDev := math.Sqrt(variance)
+			width := time.Duration(deviations * stdDev * float64(time.Second)).Round(time.Second)
+			bands[stop.ModelStop().ID()] = etaBand{
+				Low:    stop.Arrival().Add(-width),
+				High:   stop.Arrival().Add(width),
+				StdDev: stdDev,
+			}
+
+			serviceStdDev := serviceDurationStdDev(stop.ModelStop())
+			variance += serviceStdDev * serviceStdDev
+		}
+	}
+
+	return bands
+}
+
+// serviceDurationStdDev returns the standard deviation of the service duration
+// of the stop, as given in its custom data. It is 0 if not given.
+func serviceDurationStdDev(stop nextroute.ModelStop) float64 {
+	inputStop, ok := stop.Data().(schema.Stop)
+	if !ok {
+		return 0
+	}
+	customData, ok := inputStop.CustomData.(map[string]any)
+	if !ok {
+		return 0
+	}
+	stdDev, ok := customData["service_duration_std_dev"].(float64)
+	if !ok || stdDev < 0 {
+		return 0
+	}
+
+	return stdDev
+}
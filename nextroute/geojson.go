@@ -0,0 +1,108 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+
+	"github.com/nextmv-io/nextroute"
+	"github.com/nextmv-io/nextroute/common"
+)
+
+// featureCollection is a GeoJSON feature collection of the routes and stops
+// of a solution.
+type featureCollection struct {
+	Type     string    `json:"type"`
+	Features []feature `json:"features"`
+}
+
+// feature is a GeoJSON feature. Routes are line strings, stops are points.
+type feature struct {
+	Type       string         `json:"type"`
+	Geometry   geometry       `json:"geometry"`
+	Properties map[string]any `json:"properties"`
+}
+
+// geometry is a GeoJSON geometry. Positions are given as longitude and
+// latitude.
+type geometry struct {
+	Type        string `json:"type"`
+	Coordinates any    `json:"coordinates"`
+}
+
+// writeGeoJSON writes the routes and stops of the solution as a GeoJSON
+// feature collection to the file at the given path.
+func writeGeoJSON(path string, solution nextroute.Solution) error {
+	b, err := json.MarshalIndent(newFeatureCollection(solution), "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(path, b, 0o644)
+}
+
+// newFeatureCollection returns a line string per vehicle with planned stops,
+// from its start to its end location, and a point per stop. Stops and
+// vehicle start and end locations without a valid location are left out.
+func newFeatureCollection(solution nextroute.Solution) featureCollection {
+	collection := featureCollection{
+		Type:     "FeatureCollection",
+		Features: make([]feature, 0),
+	}
+
+	for _, vehicle := range solution.Vehicles() {
+		if vehicle.IsEmpty() {
+			continue
+		}
+		coordinates := make([][2]float64, 0, vehicle.NumberOfStops()+2)
+		for _, stop := range vehicle.SolutionStops() {
+			location := stop.ModelStop().Location()
+			if !location.IsValid() {
+				continue
+			}
+			coordinates = append(coordinates, position(location))
+		}
+		if len(coordinates) < 2 {
+			continue
+		}
+		collection.Features = append(collection.Features, feature{
+			Type: "Feature",
+			Geometry: geometry{
+				Type:        "LineString",
+				Coordinates: coordinates,
+			},
+			Properties: map[string]any{
+				"vehicle_id": vehicle.ModelVehicle().ID(),
+			},
+		})
+	}
+
+	for _, modelStop := range solution.Model().Stops() {
+		if modelStop.IsFirstOrLast() || !modelStop.Location().IsValid() {
+			continue
+		}
+		properties := map[string]any{
+			"id":      modelStop.ID(),
+			"planned": false,
+		}
+		if stop := solution.SolutionStop(modelStop); stop.IsPlanned() {
+			properties["planned"] = true
+			properties["vehicle_id"] = stop.Vehicle().ModelVehicle().ID()
+			properties["position"] = stop.Position()
+		}
+		collection.Features = append(collection.Features, feature{
+			Type: "Feature",
+			Geometry: geometry{
+				Type:        "Point",
+				Coordinates: position(modelStop.Location()),
+			},
+			Properties: properties,
+		})
+	}
+
+	return collection
+}
+
+// position returns the GeoJSON position of the location.
+func position(location common.Location) [2]float64 {
+	return [2]float64{location.Longitude(), location.Latitude()}
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/nextmv-io/nextroute/schema"
+)
+
+// withInitialSolution returns the input in which the routes of the last
+// solution of a previous output, read from the file at the given path, are the
+// initial stops of the vehicles. The solver starts from these routes. Stops of
+// the input that are not on any route start unplanned, stops and vehicles of
+// the output that are not in the input are ignored. Vehicles with locked stops
+// keep them instead.
+func withInitialSolution(input schema.Input, path string) (schema.Input, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return schema.Input{}, err
+	}
+	var output struct {
+		Solutions []schema.SolutionOutput `json:"solutions"`
+	}
+	if err := json.Unmarshal(b, &output); err != nil {
+		return schema.Input{}, fmt.Errorf("initial solution %q: %w", path, err)
+	}
+	if len(output.Solutions) == 0 {
+		return schema.Input{}, fmt.Errorf("initial solution %q: no solutions", path)
+	}
+	solution := output.Solutions[len(output.Solutions)-1]
+
+	stops := make(map[string]bool, len(input.Stops))
+	for _, stop := range input.Stops {
+		stops[stop.ID] = true
+	}
+	routes := make(map[string][]schema.InitialStop, len(solution.Vehicles))
+	// stop ID -> ID of the vehicle it is planned on.
+	planned := map[string]string{}
+	for _, vehicle := range solution.Vehicles {
+		route := make([]schema.InitialStop, 0, len(vehicle.Route))
+		for _, stop := range vehicle.Route {
+			// The start and the end of the vehicle are not input stops.
+			if !stops[stop.Stop.ID] {
+				continue
+			}
+			if other, ok := planned[stop.Stop.ID]; ok {
+				return schema.Input{}, fmt.Errorf(
+					"initial solution %q: stop %q is planned on vehicles %q and %q", path, stop.Stop.ID, other, vehicle.ID,
+				)
+			}
+			planned[stop.Stop.ID] = vehicle.ID
+			route = append(route, schema.InitialStop{ID: stop.Stop.ID})
+		}
+		routes[vehicle.ID] = route
+	}
+
+	vehicles := make([]schema.Vehicle, len(input.Vehicles))
+	copy(vehicles, input.Vehicles)
+	for i, vehicle := range vehicles {
+		locked, err := lockedStops(vehicle)
+		if err != nil {
+			return schema.Input{}, err
+		}
+		route, ok := routes[vehicle.ID]
+		if !ok || len(locked) > 0 {
+			continue
+		}
+		vehicles[i].InitialStops = &route
+	}
+	input.Vehicles = vehicles
+
+	return input, nil
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/nextmv-io/nextroute"
+	"github.com/nextmv-io/nextroute/schema"
+)
+
+// lockedRoute reports whether the locked stops of a vehicle are planned on it
+// in the given order.
+type lockedRoute struct {
+	VehicleID string   `json:"vehicle_id"`
+	Stops     []string `json:"stops"`
+	Honored   bool     `json:"honored"`
+}
+
+// lockedStops returns the IDs of the stops that are locked onto the vehicle
+// in the given order, as listed in locked_stops of its custom data.
+func lockedStops(vehicle schema.Vehicle) ([]string, error) {
+	if _, ok := vehicle.CustomData.(map[string]any); !ok {
+		return nil, nil
+	}
+	customData, err := schema.ConvertCustomData[struct {
+		LockedStops []string `json:"locked_stops"`
+	}](vehicle.CustomData)
+	if err != nil {
+		return nil, fmt.Errorf("vehicle %q: locked_stops: %w", vehicle.ID, err)
+	}
+
+	return customData.LockedStops, nil
+}
+
+// withLockedStops returns the input in which the locked stops of every vehicle
+// are its fixed initial stops. Fixed stops stay on the vehicle in their order,
+// while the solver is free to plan other stops before, after and in between
+// them.
+func withLockedStops(input schema.Input) (schema.Input, error) {
+	vehicles := make([]schema.Vehicle, len(input.Vehicles))
+	copy(vehicles, input.Vehicles)
+
+	// stop ID -> ID of the vehicle it is locked onto.
+	locked := map[string]string{}
+	for i, vehicle := range vehicles {
+		stops, err := lockedStops(vehicle)
+		if err != nil {
+			return schema.Input{}, err
+		}
+		if len(stops) == 0 {
+			continue
+		}
+		if vehicle.InitialStops != nil {
+			return schema.Input{}, fmt.Errorf("vehicle %q: locked_stops cannot be combined with initial_stops", vehicle.ID)
+		}
+
+		fixed := true
+		initialStops := make([]schema.InitialStop, len(stops))
+		for j, stop := range stops {
+			if other, ok := locked[stop]; ok {
+				return schema.Input{}, fmt.Errorf(
+					"vehicle %q: stop %q is already locked onto vehicle %q", vehicle.ID, stop, other,
+				)
+			}
+			locked[stop] = vehicle.ID
+			initialStops[j] = schema.InitialStop{ID: stop, Fixed: &fixed}
+		}
+		vehicles[i].InitialStops = &initialStops
+	}
+	input.Vehicles = vehicles
+
+	return input, nil
+}
+
+// lockedRoutes checks for every vehicle with locked stops whether they are
+// planned on it in their order.
+func lockedRoutes(input schema.Input, solution nextroute.Solution) ([]lockedRoute, error) {
+	routes := make([]lockedRoute, 0)
+	for i, vehicle := range input.Vehicles {
+		stops, err := lockedStops(vehicle)
+		if err != nil {
+			return nil, err
+		}
+		if len(stops) == 0 {
+			continue
+		}
+
+		// The locked stops must be a subsequence of the route.
+		next := 0
+		for _, stop := range solution.Vehicles()[i].SolutionStops() {
+			if next < len(stops) && stop.ModelStop().ID() == stops[next] {
+				next++
+			}
+		}
+		routes = append(routes, lockedRoute{
+			VehicleID: vehicle.ID,
+			Stops:     stops,
+			Honored:   next == len(stops),
+		})
+	}
+
+	return routes, nil
+}
@@ -22,10 +22,36 @@ func main() {
 }
 
 type options struct {
-	Model  factory.Options                `json:"model,omitempty"`
-	Solve  nextroute.ParallelSolveOptions `json:"solve,omitempty"`
-	Format nextroute.FormatOptions        `json:"format,omitempty"`
-	Check  check.Options                  `json:"check,omitempty"`
+	Model     factory.Options                `json:"model,omitempty"`
+	Solve     nextroute.ParallelSolveOptions `json:"solve,omitempty"`
+	Format    nextroute.FormatOptions        `json:"format,omitempty"`
+	Check     check.Options                  `json:"check,omitempty"`
+	Crossings struct {
+		Penalty float64 `json:"penalty" usage:"penalty for every self-intersection of a route"`
+	} `json:"crossings,omitempty"`
+	ETA struct {
+		Bands      bool    `json:"bands" usage:"report ETA bands based on the service duration variability of the stops"`
+		Deviations float64 `json:"deviations" default:"2" usage:"number of standard deviations spanned by an ETA band"`
+	} `json:"eta,omitempty"`
+	Constraints struct {
+		Custom []string `json:"custom" usage:"additional constraints, e.g. refrigerated,latest_arrival,first_stop"`
+	} `json:"constraints,omitempty"`
+	GeoJSON struct {
+		Path string `json:"path" usage:"write the routes and stops as a GeoJSON feature collection to this file"`
+	} `json:"geojson,omitempty"`
+	OSRM osrmOptions `json:"osrm,omitempty"`
+	// DistanceMetric is the metric of the distances between the locations,
+	// unless the input or OSRM define a distance matrix.
+	DistanceMetric string `json:"distance_metric" default:"haversine" usage:"{haversine, manhattan, euclidean} metric"`
+	Balance        struct {
+		Weight float64 `json:"weight" usage:"weight of the spread between the longest and the shortest route duration"`
+	} `json:"balance,omitempty"`
+	InitialSolution struct {
+		Path string `json:"path" usage:"continue from the solution of a previous output in this file"`
+	} `json:"initial_solution,omitempty"`
+	MustServe struct {
+		Penalty int `json:"penalty" default:"1000000000" usage:"unplanned penalty of the stops marked as must_serve"`
+	} `json:"must_serve,omitempty"`
 }
 
 func solver(
@@ -33,26 +59,108 @@ func solver(
 	input schema.Input,
 	options options,
 ) (runSchema.Output, error) {
+	// Lock the stops listed in the custom data of the vehicles onto them.
+	input, err := withLockedStops(input)
+	if err != nil {
+		return runSchema.Output{}, err
+	}
+
+	// Start from the routes of a previous solution, if requested.
+	if options.InitialSolution.Path != "" {
+		input, err = withInitialSolution(input, options.InitialSolution.Path)
+		if err != nil {
+			return runSchema.Output{}, err
+		}
+	}
+
+	// Make leaving must-serve stops unplanned outweigh all other costs.
+	input, err = withMustServeStops(input, options.MustServe.Penalty, options.Model.Objectives.UnplannedPenalty)
+	if err != nil {
+		return runSchema.Output{}, err
+	}
+
+	// Load deliveries and pickups separately, if the stops have a type.
+	input, types, err := withBackhauls(input)
+	if err != nil {
+		return runSchema.Output{}, err
+	}
+
+	// Use the travel durations and distances of an OSRM server, if requested.
+	if options.OSRM.URL != "" {
+		input = withOSRMMatrices(ctx, input, options.OSRM)
+	}
+	input, err = withDistanceMetric(input, options.DistanceMetric)
+	if err != nil {
+		return runSchema.Output{}, err
+	}
+
 	model, err := factory.NewModel(input, options.Model)
 	if err != nil {
 		return runSchema.Output{}, err
 	}
 
-	solver, err := nextroute.NewParallelSolver(model)
+	// Slow down travel during the traffic intervals of the input.
+	if err := addTraffic(model, input); err != nil {
+		return runSchema.Output{}, err
+	}
+
+	// Require the vehicles with a break rule to take their breaks.
+	breaks, err := addBreaks(model, options.Model)
 	if err != nil {
 		return runSchema.Output{}, err
 	}
 
-	solutions, err := solver.Solve(ctx, options.Solve)
+	// Serve all deliveries of a route before its pickups.
+	if types != nil {
+		constraint, err := newBackhaulConstraint(model, types)
+		if err != nil {
+			return runSchema.Output{}, err
+		}
+		if err := model.AddConstraint(constraint); err != nil {
+			return runSchema.Output{}, err
+		}
+	}
+
+	// Add the custom constraints that are selected by name.
+	if err := addCustomConstraints(model, options.Constraints.Custom); err != nil {
+		return runSchema.Output{}, err
+	}
+
+	// Penalize routes that intersect themselves, if requested.
+	if options.Crossings.Penalty > 0 {
+		if _, err := model.Objective().NewTerm(options.Crossings.Penalty, crossingsObjective{}); err != nil {
+			return runSchema.Output{}, err
+		}
+	}
+
+	// Balance the route durations of the vehicles, if requested.
+	if options.Balance.Weight > 0 {
+		if _, err := model.Objective().NewTerm(options.Balance.Weight, balanceObjective{}); err != nil {
+			return runSchema.Output{}, err
+		}
+	}
+
+	solver, err := nextroute.NewParallelSolver(model)
 	if err != nil {
 		return runSchema.Output{}, err
 	}
 
-	last, err := solutions.Last()
+	solutions, err := solver.Solve(ctx, options.Solve)
 	if err != nil {
 		return runSchema.Output{}, err
 	}
 
+	var first, last nextroute.Solution
+	for info := range solutions {
+		if info.Error != nil {
+			return runSchema.Output{}, info.Error
+		}
+		if first == nil {
+			first = info.Solution
+		}
+		last = info.Solution
+	}
+
 	output, err := check.Format(
 		ctx,
 		options,
@@ -63,7 +171,92 @@ func solver(
 	if err != nil {
 		return runSchema.Output{}, err
 	}
-	output.Statistics.Result.Custom = factory.DefaultCustomResultStatistics(last)
+	custom := customResultStatistics{
+		CustomResultStatistics: factory.DefaultCustomResultStatistics(last),
+		TimeWindows:            usedTimeWindows(last),
+		CustomConstraints:      options.Constraints.Custom,
+		Vehicles:               vehiclesStatistics(last),
+		Unplanned:              unplannedReasons(output),
+	}
+	custom.LockedRoutes, err = lockedRoutes(input, last)
+	if err != nil {
+		return runSchema.Output{}, err
+	}
+	custom.MustServe, err = newMustServeStatistics(input, last)
+	if err != nil {
+		return runSchema.Output{}, err
+	}
+	if options.Crossings.Penalty > 0 {
+		custom.Crossings = &crossingsStatistics{
+			Before: solutionCrossings(first),
+			After:  solutionCrossings(last),
+		}
+	}
+	if options.Balance.Weight > 0 {
+		custom.Balance = newBalanceStatistics(last)
+	}
+	if options.ETA.Bands {
+		custom.ETABands = etaBands(last, options.ETA.Deviations)
+	}
+	if breaks != nil {
+		// The formatted times do not include the breaks yet.
+		i := len(output.Solutions) - 1
+		if solution, ok := output.Solutions[i].(schema.SolutionOutput); ok {
+			applyBreaks(&solution, custom.Vehicles, last, breaks)
+			output.Solutions[i] = solution
+		}
+	}
+	output.Statistics.Result.Custom = custom
+
+	// Write the geometry of the routes for map based consumers, if requested.
+	if options.GeoJSON.Path != "" {
+		if err := writeGeoJSON(options.GeoJSON.Path, last); err != nil {
+			return runSchema.Output{}, err
+		}
+	}
 
 	return output, nil
 }
+
+// customResultStatistics extends the default custom statistics with the start
+// time window used by stops that have multiple start time windows, the
+// number of route self-intersections, the ETA bands of the stops, the custom
+// constraints added to the model, the statistics of every vehicle, the
+// reasons why stops are not planned, whether locked stops are honored, the
+// balance of the route durations and the must-serve stops that are not
+// planned.
+type customResultStatistics struct {
+	schema.CustomResultStatistics
+	TimeWindows       map[string]int       `json:"time_windows,omitempty"`
+	Crossings         *crossingsStatistics `json:"crossings,omitempty"`
+	ETABands          map[string]etaBand   `json:"eta_bands,omitempty"`
+	CustomConstraints []string             `json:"custom_constraints,omitempty"`
+	Vehicles          []vehicleStatistics  `json:"vehicles"`
+	Unplanned         []unplannedReason    `json:"unplanned,omitempty"`
+	LockedRoutes      []lockedRoute        `json:"locked_routes,omitempty"`
+	Balance           *balanceStatistics   `json:"balance,omitempty"`
+	MustServe         *mustServeStatistics `json:"must_serve,omitempty"`
+}
+
+// usedTimeWindows returns the index of the start time window in which each
+// planned stop with multiple start time windows starts its service.
+func usedTimeWindows(solution nextroute.Solution) map[string]int {
+	used := map[string]int{}
+	for _, vehicle := range solution.Vehicles() {
+		for _, stop := range vehicle.SolutionStops() {
+			windows := stop.ModelStop().Windows()
+			if len(windows) < 2 {
+				continue
+			}
+			start := stop.Start()
+			for index, window := range windows {
+				if !start.Before(window[0]) && !start.After(window[1]) {
+					used[stop.ModelStop().ID()] = index
+					break
+				}
+			}
+		}
+	}
+
+	return used
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+
+	"github.com/nextmv-io/nextroute"
+	"github.com/nextmv-io/nextroute/schema"
+)
+
+// mustServe returns whether the stop is marked as must_serve in its custom
+// data.
+func mustServe(stop schema.Stop) (bool, error) {
+	if _, ok := stop.CustomData.(map[string]any); !ok {
+		return false, nil
+	}
+	customData, err := schema.ConvertCustomData[struct {
+		MustServe bool `json:"must_serve"`
+	}](stop.CustomData)
+	if err != nil {
+		return false, fmt.Errorf("stop %q: must_serve: %w", stop.ID, err)
+	}
+
+	return customData.MustServe, nil
+}
+
+// withMustServeStops returns the input in which every must-serve stop has an
+// unplanned penalty of at least the given penalty. Leaving such a stop
+// unplanned then outweighs any other cost of a solution.
+func withMustServeStops(input schema.Input, penalty int, unplannedPenalty float64) (schema.Input, error) {
+	stops := make([]schema.Stop, len(input.Stops))
+	copy(stops, input.Stops)
+	for i, stop := range stops {
+		ok, err := mustServe(stop)
+		if err != nil {
+			return schema.Input{}, err
+		}
+		if !ok {
+			continue
+		}
+		if unplannedPenalty == 0 {
+			return schema.Input{}, errors.New("must_serve stops require the unplanned objective, it is disabled")
+		}
+		if stop.UnplannedPenalty != nil && *stop.UnplannedPenalty >= penalty {
+			continue
+		}
+		stops[i].UnplannedPenalty = &penalty
+	}
+	input.Stops = stops
+
+	return input, nil
+}
+
+// mustServeStatistics lists the must-serve stops that could not be planned.
+type mustServeStatistics struct {
+	Unplanned []string `json:"unplanned"`
+}
+
+// newMustServeStatistics returns the statistics of the must-serve stops, nil
+// if there are none. A warning is logged for the ones that are not planned.
+func newMustServeStatistics(input schema.Input, solution nextroute.Solution) (*mustServeStatistics, error) {
+	var statistics *mustServeStatistics
+	for i, stop := range input.Stops {
+		ok, err := mustServe(stop)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			continue
+		}
+		if statistics == nil {
+			statistics = &mustServeStatistics{Unplanned: make([]string, 0)}
+		}
+		// The model stops start with the stops of the input, in their order.
+		modelStop, err := solution.Model().Stop(i)
+		if err != nil {
+			return nil, err
+		}
+		if !solution.SolutionStop(modelStop).IsPlanned() {
+			statistics.Unplanned = append(statistics.Unplanned, stop.ID)
+		}
+	}
+	if statistics != nil && len(statistics.Unplanned) > 0 {
+		log.Printf("warning: must_serve stops are not planned: %q", statistics.Unplanned)
+	}
+
+	return statistics, nil
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/nextmv-io/nextroute/schema"
+)
+
+// osrmOptions configure fetching the travel durations and distances from an
+// OSRM server.
+type osrmOptions struct {
+	URL     string        `json:"url" usage:"base URL of an OSRM server to fetch the travel durations and distances from"`
+	Profile string        `json:"profile" default:"driving" usage:"OSRM profile, e.g. driving or cycling"`
+	Timeout time.Duration `json:"timeout" default:"30s" usage:"timeout of the OSRM request"`
+}
+
+// withOSRMMatrices returns the input with the duration and distance matrix
+// fetched from the OSRM server, unless the input already defines them. If the
+// matrices cannot be fetched, a warning is logged and the input is returned
+// unchanged, so that the haversine distances are used.
+func withOSRMMatrices(ctx context.Context, input schema.Input, options osrmOptions) schema.Input {
+	if input.DurationMatrix != nil && input.DistanceMatrix != nil {
+		return input
+	}
+	if input.AlternateStops != nil {
+		log.Printf("warning: OSRM matrices are not supported with alternate stops, using haversine distances")
+		return input
+	}
+
+	durations, distances, err := osrmMatrices(ctx, options.URL, options.Profile, options.Timeout, input)
+	if err != nil {
+		log.Printf("warning: fetching the OSRM matrices failed, using haversine distances: %v", err)
+		return input
+	}
+	if input.DurationMatrix == nil {
+		input.DurationMatrix = &durations
+	}
+	if input.DistanceMatrix == nil {
+		input.DistanceMatrix = &distances
+	}
+
+	return input
+}
+
+// osrmResponse is the response of the table service of an OSRM server.
+// Durations are in seconds and distances in meters, unreachable pairs of
+// locations are null.
+type osrmResponse struct {
+	Code      string       `json:"code"`
+	Message   string       `json:"message"`
+	Durations [][]*float64 `json:"durations"`
+	Distances [][]*float64 `json:"distances"`
+}
+
+// osrmMatrices fetches the duration and distance matrix of the input from the
+// table service of the OSRM server at the given base URL. The matrices follow
+// the layout expected by nextroute: the stops first, followed by the start and
+// end location of every vehicle. Vehicles without a start or end location
+// travel to and from it at no cost.
+func osrmMatrices(
+	ctx context.Context,
+	baseURL string,
+	profile string,
+	timeout time.Duration,
+	input schema.Input,
+) (durations, distances [][]float64, err error) {
+	locations := matrixLocations(input)
+
+	// Only valid locations are sent to the server, indices maps them back to
+	// the matrix.
+	coordinates := make([]string, 0, len(locations))
+	indices := make([]int, len(locations))
+	for i, location := range locations {
+		indices[i] = -1
+		if location == nil {
+			continue
+		}
+		indices[i] = len(coordinates)
+		coordinates = append(coordinates, fmt.Sprintf("%v,%v", location.Lon, location.Lat))
+	}
+
+	endpoint, err := url.JoinPath(baseURL, "table", "v1", profile, strings.Join(coordinates, ";"))
+	if err != nil {
+		return nil, nil, err
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint+"?annotations=duration,distance", nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	response, err := http.DefaultClient.Do(request)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer response.Body.Close()
+
+	var table osrmResponse
+	if err := json.NewDecoder(response.Body).Decode(&table); err != nil {
+		return nil, nil, fmt.Errorf("decoding OSRM response with status %q: %w", response.Status, err)
+	}
+	if table.Code != "Ok" {
+		return nil, nil, fmt.Errorf("OSRM responded with code %q: %s", table.Code, table.Message)
+	}
+
+	durations, err = osrmMatrix(table.Durations, indices, len(coordinates))
+	if err != nil {
+		return nil, nil, fmt.Errorf("OSRM durations: %w", err)
+	}
+	distances, err = osrmMatrix(table.Distances, indices, len(coordinates))
+	if err != nil {
+		return nil, nil, fmt.Errorf("OSRM distances: %w", err)
+	}
+
+	return durations, distances, nil
+}
+
+// osrmMatrix maps the table of the valid locations back to the full matrix.
+// Entries of locations without a valid location are 0.
+func osrmMatrix(table [][]*float64, indices []int, size int) ([][]float64, error) {
+	if len(table) != size {
+		return nil, fmt.Errorf("got %d rows; want %d", len(table), size)
+	}
+	matrix := make([][]float64, len(indices))
+	for i, from := range indices {
+		matrix[i] = make([]float64, len(indices))
+		if from < 0 {
+			continue
+		}
+		if len(table[from]) != size {
+			return nil, fmt.Errorf("row %d: got %d columns; want %d", from, len(table[from]), size)
+		}
+		for j, to := range indices {
+			if to < 0 {
+				continue
+			}
+			if table[from][to] == nil {
+				return nil, fmt.Errorf("location %d is unreachable from location %d", j, i)
+			}
+			matrix[i][j] = *table[from][to]
+		}
+	}
+
+	return matrix, nil
+}
+
+// matrixLocations returns the locations of the stops followed by the start
+// and end location of every vehicle, nil if a vehicle has none.
+func matrixLocations(input schema.Input) []*schema.Location {
+	var defaults schema.VehicleDefaults
+	if input.Defaults != nil && input.Defaults.Vehicles != nil {
+		defaults = *input.Defaults.Vehicles
+	}
+
+	locations := make([]*schema.Location, 0, len(input.Stops)+2*len(input.Vehicles))
+	for _, stop := range input.Stops {
+		location := stop.Location
+		locations = append(locations, &location)
+	}
+	for _, vehicle := range input.Vehicles {
+		start, end := vehicle.StartLocation, vehicle.EndLocation
+		if start == nil {
+			start = defaults.StartLocation
+		}
+		if end == nil {
+			end = defaults.EndLocation
+		}
+		locations = append(locations, start, end)
+	}
+
+	return locations
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/nextmv-io/nextroute"
+	"github.com/nextmv-io/nextroute/schema"
+)
+
+// trafficInterval scales the travel durations of the vehicles that depart
+// from a stop in [Start, End) by Multiplier, e.g. 1.5 during rush hour.
+type trafficInterval struct {
+	Start      time.Time `json:"start"`
+	End        time.Time `json:"end"`
+	Multiplier float64   `json:"multiplier"`
+}
+
+// traffic returns the intervals listed in traffic of the custom data of the
+// input.
+func traffic(input schema.Input) ([]trafficInterval, error) {
+	if _, ok := input.CustomData.(map[string]any); !ok {
+		return nil, nil
+	}
+	customData, err := schema.ConvertCustomData[struct {
+		Traffic []trafficInterval `json:"traffic"`
+	}](input.CustomData)
+	if err != nil {
+		return nil, fmt.Errorf("traffic: %w", err)
+	}
+
+	return customData.Traffic, nil
+}
+
+// addTraffic makes the travel durations of all vehicle types depend on the
+// departure time, following the traffic intervals of the input. Outside of
+// the intervals, the travel durations are unchanged.
+func addTraffic(model nextroute.Model, input schema.Input) error {
+	intervals, err := traffic(input)
+	if err != nil {
+		return err
+	}
+	if len(intervals) == 0 {
+		return nil
+	}
+	for i, interval := range intervals {
+		if interval.Multiplier <= 0 {
+			return fmt.Errorf("traffic interval %d: multiplier must be positive, it is %v", i, interval.Multiplier)
+		}
+	}
+
+	for _, vehicleType := range model.VehicleTypes() {
+		base := vehicleType.TravelDurationExpression().DefaultExpression()
+		expression, err := nextroute.NewTimeDependentDurationExpression(model, base)
+		if err != nil {
+			return err
+		}
+		for i, interval := range intervals {
+			scaled := nextroute.NewScaledDurationExpression(base, interval.Multiplier)
+			if err := expression.SetExpression(interval.Start, interval.End, scaled); err != nil {
+				return fmt.Errorf("traffic interval %d: %w", i, err)
+			}
+		}
+		if err := vehicleType.SetTravelDurationExpression(expression); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"github.com/nextmv-io/nextroute/schema"
+	runSchema "github.com/nextmv-io/sdk/run/schema"
+)
+
+// unplannedReason is the most binding reason why a stop is not planned.
+type unplannedReason struct {
+	StopID string `json:"stop_id"`
+	Reason string `json:"reason"`
+}
+
+// unplannedReasons returns the reason why each unplanned stop of the last
+// solution of the output is not planned, as found by the check. Without a
+// check, no reasons are returned. The reason is the constraint that prevented
+// the most moves of the plan unit of the stop. If the plan unit could be
+// planned, but only at a cost higher than leaving it unplanned, the reason is
+// objective.
+func unplannedReasons(output runSchema.Output) []unplannedReason {
+	if len(output.Solutions) == 0 {
+		return nil
+	}
+	solution, ok := output.Solutions[len(output.Solutions)-1].(schema.SolutionOutput)
+	if !ok || solution.Check == nil {
+		return nil
+	}
+
+	reasons := make([]unplannedReason, 0)
+	for _, planUnit := range solution.Check.PlanUnits {
+		reason := "unknown"
+		if planUnit.HasBestMove && planUnit.BestMoveIncreasesObjective {
+			reason = "objective"
+		}
+		if planUnit.Constraints != nil {
+			violations := 0
+			for constraint, count := range *planUnit.Constraints {
+				if count > violations || count == violations && constraint < reason {
+					reason, violations = constraint, count
+				}
+			}
+		}
+		for _, stopID := range planUnit.Stops {
+			reasons = append(reasons, unplannedReason{StopID: stopID, Reason: reason})
+		}
+	}
+
+	return reasons
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"time"
+
+	"github.com/nextmv-io/nextroute"
+	"github.com/nextmv-io/nextroute/factory"
+)
+
+// vehicleStatistics summarizes the route of a vehicle. Durations are in
+// seconds and distances in meters. End is the time the vehicle ends its
+// route; it is not reported for vehicles without a start time.
+type vehicleStatistics struct {
+	ID             string     `json:"id"`
+	Stops          int        `json:"stops"`
+	TravelDistance int        `json:"travel_distance"`
+	Duration       int        `json:"duration"`
+	End            *time.Time `json:"end,omitempty"`
+}
+
+// vehiclesStatistics returns the statistics of the route of every vehicle,
+// including the vehicles that are not used.
+func vehiclesStatistics(solution nextroute.Solution) []vehicleStatistics {
+	// The travel distance is only known to the formatter of the factory.
+	distances := map[string]int{}
+	for _, vehicle := range factory.ToSolutionOutput(solution).Vehicles {
+		distances[vehicle.ID] = vehicle.RouteTravelDistance
+	}
+
+	vehicles := make([]vehicleStatistics, 0, len(solution.Vehicles()))
+	for _, vehicle := range solution.Vehicles() {
+		modelVehicle := vehicle.ModelVehicle()
+		statistics := vehicleStatistics{
+			ID:             modelVehicle.ID(),
+			Stops:          vehicle.NumberOfStops(),
+			TravelDistance: distances[modelVehicle.ID()],
+			Duration:       int(vehicle.Duration().Seconds()),
+		}
+		if vehicle.Start() != modelVehicle.Model().Epoch() {
+			end := vehicle.End().In(modelVehicle.Start().Location())
+			statistics.End = &end
+		}
+		vehicles = append(vehicles, statistics)
+	}
+
+	return vehicles
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+// buildProgress tracks how far the construction of the model got. It is used
+// to abort the construction once the build timeout is exceeded.
+type buildProgress struct {
+	timeout     time.Duration
+	deadline    time.Time
+	stage       string
+	items       int
+	totalItems  int
+	assignments int
+}
+
+// newBuildProgress returns the progress of a model build for the given number
+// of items. A timeout of 0 disables the limit.
+func newBuildProgress(timeout time.Duration, totalItems int) *buildProgress {
+	p := &buildProgress{
+		timeout:    timeout,
+		totalItems: totalItems,
+	}
+	if timeout > 0 {
+		p.deadline = time.Now().Add(timeout)
+	}
+	return p
+}
+
+// check returns a buildTimeoutError if the build timeout is exceeded.
+func (p *buildProgress) check() error {
+	if p.deadline.IsZero() || time.Now().Before(p.deadline) {
+		return nil
+	}
+	return buildTimeoutError{
+		Timeout:     p.timeout,
+		Stage:       p.stage,
+		Items:       p.items,
+		TotalItems:  p.totalItems,
+		Assignments: p.assignments,
+	}
+}
+
+// buildTimeoutError is returned if the construction of the model exceeds the
+// build timeout. It reports how far the construction got.
+type buildTimeoutError struct {
+	Timeout     time.Duration
+	Stage       string
+	Items       int
+	TotalItems  int
+	Assignments int
+}
+
+func (e buildTimeoutError) Error() string {
+	return fmt.Sprintf(
+		"build timeout of %v exceeded while %s: %d of %d items processed, %d assignments created",
+		e.Timeout, e.Stage, e.Items, e.TotalItems, e.Assignments,
+	)
+}
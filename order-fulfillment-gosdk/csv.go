@@ -0,0 +1,85 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+)
+
+// csvHeader holds the columns of the per-carrier cost breakdown.
+var csvHeader = []string{
+	"distribution_center_id",
+	"carrier_id",
+	"cartons",
+	"volume",
+	"weight",
+	"billable_weight",
+	"weight_tier",
+	"delivery_cost",
+}
+
+// writeCSV writes a row per distribution center carrier combination of the
+// solution to the given path. Rows are sorted by distribution center and
+// carrier.
+func writeCSV(path string, s oflSolution, carriers []carrier) error {
+	sorted := make([]carrier, len(carriers))
+	copy(sorted, carriers)
+	sort.Slice(sorted, func(a, b int) bool {
+		if sorted[a].DistributionCenter.DistributionCenterID != sorted[b].DistributionCenter.DistributionCenterID {
+			return sorted[a].DistributionCenter.DistributionCenterID < sorted[b].DistributionCenter.DistributionCenterID
+		}
+		return sorted[a].Carrier < sorted[b].Carrier
+	})
+
+	var b bytes.Buffer
+	w := csv.NewWriter(&b)
+	if err := w.Write(csvHeader); err != nil {
+		return fmt.Errorf("write csv: %w", err)
+	}
+	for _, c := range sorted {
+		key := c.ID()
+		record := []string{
+			c.DistributionCenter.DistributionCenterID,
+			c.Carrier,
+			formatFloat(s.Cartons[key]),
+			formatFloat(s.Volumes[key]),
+			formatFloat(s.Weights[key]),
+			formatFloat(s.BillableWeights[key]),
+			strconv.Itoa(selectedTier(s.WeightTiers[key])),
+			formatFloat(s.DeliveryCosts[key]),
+		}
+		if err := w.Write(record); err != nil {
+			return fmt.Errorf("write csv: %w", err)
+		}
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return fmt.Errorf("write csv: %w", err)
+	}
+
+	if err := os.WriteFile(filepath.Clean(path), b.Bytes(), 0o600); err != nil {
+		return fmt.Errorf("write csv: %w", err)
+	}
+
+	return nil
+}
+
+// selectedTier returns the index of the selected weight tier, or -1 if no tier
+// is selected.
+func selectedTier(tiers map[int]int) int {
+	for index, selected := range tiers {
+		if selected == 1 {
+			return index
+		}
+	}
+	return -1
+}
+
+// formatFloat formats a value of the CSV with the fewest digits necessary.
+func formatFloat(value float64) string {
+	return strconv.FormatFloat(value, 'f', -1, 64)
+}
@@ -0,0 +1,225 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/nextmv-io/go-mip"
+)
+
+// exportModel writes the model to the given path. The format is inferred from
+// the file extension, supported are LP (.lp) and free MPS (.mps) files.
+func exportModel(m mip.Model, path string) error {
+	var content string
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".lp":
+		content = lpFormat(m)
+	case ".mps":
+		content = mpsFormat(m)
+	default:
+		return fmt.Errorf("export model: unsupported file extension of %q, use .lp or .mps", path)
+	}
+
+	if err := os.WriteFile(filepath.Clean(path), []byte(content), 0o600); err != nil {
+		return fmt.Errorf("export model: %w", err)
+	}
+
+	return nil
+}
+
+// varName returns the name of a variable in the exported model.
+func varName(v mip.Var) string {
+	return fmt.Sprintf("x%d", v.Index())
+}
+
+// constraintName returns the name of a constraint in the exported model.
+func constraintName(index int) string {
+	return fmt.Sprintf("c%d", index)
+}
+
+// lpFormat returns the model in the LP file format.
+func lpFormat(m mip.Model) string {
+	var b strings.Builder
+
+	if m.Objective().IsMaximize() {
+		b.WriteString("Maximize\n")
+	} else {
+		b.WriteString("Minimize\n")
+	}
+	b.WriteString(" obj:")
+	writeLPTerms(&b, m.Objective().Terms())
+	b.WriteString("\n")
+
+	b.WriteString("Subject To\n")
+	for index, constraint := range m.Constraints() {
+		fmt.Fprintf(&b, " %s:", constraintName(index))
+		terms := constraint.Terms()
+		if len(terms) == 0 && len(m.Vars()) > 0 {
+			fmt.Fprintf(&b, " 0 %s", varName(m.Vars()[0]))
+		}
+		writeLPTerms(&b, terms)
+		fmt.Fprintf(&b, " %s %g\n", lpSense(constraint.Sense()), constraint.RightHandSide())
+	}
+
+	b.WriteString("Bounds\n")
+	var generals, binaries []string
+	for _, v := range m.Vars() {
+		switch {
+		case v.IsBool():
+			binaries = append(binaries, varName(v))
+			continue
+		case v.IsInt():
+			generals = append(generals, varName(v))
+		}
+		fmt.Fprintf(&b, " %s <= %s <= %s\n", lpBound(v.LowerBound()), varName(v), lpBound(v.UpperBound()))
+	}
+
+	if len(generals) > 0 {
+		fmt.Fprintf(&b, "Generals\n %s\n", strings.Join(generals, " "))
+	}
+	if len(binaries) > 0 {
+		fmt.Fprintf(&b, "Binaries\n %s\n", strings.Join(binaries, " "))
+	}
+	b.WriteString("End\n")
+
+	return b.String()
+}
+
+// writeLPTerms writes the given terms, breaking the line regularly as LP files
+// limit the length of a line. The terms are written in the order of their
+// variables, as the model does not keep them in a fixed order.
+func writeLPTerms(b *strings.Builder, terms mip.Terms) {
+	terms = slices.Clone(terms)
+	slices.SortFunc(terms, func(a, b mip.Term) int {
+		return a.Var().Index() - b.Var().Index()
+	})
+	for index, term := range terms {
+		if index > 0 && index%10 == 0 {
+			b.WriteString("\n   ")
+		}
+		fmt.Fprintf(b, " %+g %s", term.Coefficient(), varName(term.Var()))
+	}
+}
+
+// lpSense returns the LP file operator of a constraint sense.
+func lpSense(sense mip.Sense) string {
+	switch sense {
+	case mip.LessThanOrEqual:
+		return "<="
+	case mip.GreaterThanOrEqual:
+		return ">="
+	default:
+		return "="
+	}
+}
+
+// lpBound returns the LP file representation of a variable bound.
+func lpBound(bound float64) string {
+	switch {
+	case bound >= math.MaxFloat64:
+		return "+inf"
+	case bound <= -math.MaxFloat64:
+		return "-inf"
+	default:
+		return fmt.Sprintf("%g", bound)
+	}
+}
+
+// mpsFormat returns the model in the free MPS file format.
+func mpsFormat(m mip.Model) string {
+	var b strings.Builder
+
+	b.WriteString("NAME order-fulfillment\n")
+	b.WriteString("OBJSENSE\n")
+	if m.Objective().IsMaximize() {
+		b.WriteString("    MAX\n")
+	} else {
+		b.WriteString("    MIN\n")
+	}
+
+	b.WriteString("ROWS\n")
+	b.WriteString(" N obj\n")
+	for index, constraint := range m.Constraints() {
+		fmt.Fprintf(&b, " %s %s\n", mpsSense(constraint.Sense()), constraintName(index))
+	}
+
+	// MPS files are column oriented, so we collect the coefficients of every
+	// variable first.
+	type entry struct {
+		row         string
+		coefficient float64
+	}
+	columns := make([][]entry, len(m.Vars()))
+	for _, term := range m.Objective().Terms() {
+		index := term.Var().Index()
+		columns[index] = append(columns[index], entry{row: "obj", coefficient: term.Coefficient()})
+	}
+	for c, constraint := range m.Constraints() {
+		for _, term := range constraint.Terms() {
+			index := term.Var().Index()
+			columns[index] = append(columns[index], entry{row: constraintName(c), coefficient: term.Coefficient()})
+		}
+	}
+
+	b.WriteString("COLUMNS\n")
+	for _, v := range m.Vars() {
+		integer := v.IsBool() || v.IsInt()
+		if integer {
+			b.WriteString("    MARKER 'MARKER' 'INTORG'\n")
+		}
+		if len(columns[v.Index()]) == 0 {
+			fmt.Fprintf(&b, "    %s obj 0\n", varName(v))
+		}
+		for _, e := range columns[v.Index()] {
+			fmt.Fprintf(&b, "    %s %s %g\n", varName(v), e.row, e.coefficient)
+		}
+		if integer {
+			b.WriteString("    MARKER 'MARKER' 'INTEND'\n")
+		}
+	}
+
+	b.WriteString("RHS\n")
+	for index, constraint := range m.Constraints() {
+		if constraint.RightHandSide() != 0 {
+			fmt.Fprintf(&b, "    RHS %s %g\n", constraintName(index), constraint.RightHandSide())
+		}
+	}
+
+	b.WriteString("BOUNDS\n")
+	for _, v := range m.Vars() {
+		name := varName(v)
+		if v.IsBool() {
+			fmt.Fprintf(&b, " BV BND %s\n", name)
+			continue
+		}
+		if v.LowerBound() <= -math.MaxFloat64 {
+			fmt.Fprintf(&b, " MI BND %s\n", name)
+		} else {
+			fmt.Fprintf(&b, " LO BND %s %g\n", name, v.LowerBound())
+		}
+		if v.UpperBound() >= math.MaxFloat64 {
+			fmt.Fprintf(&b, " PL BND %s\n", name)
+		} else {
+			fmt.Fprintf(&b, " UP BND %s %g\n", name, v.UpperBound())
+		}
+	}
+	b.WriteString("ENDATA\n")
+
+	return b.String()
+}
+
+// mpsSense returns the MPS row type of a constraint sense.
+func mpsSense(sense mip.Sense) string {
+	switch sense {
+	case mip.LessThanOrEqual:
+		return "L"
+	case mip.GreaterThanOrEqual:
+		return "G"
+	default:
+		return "E"
+	}
+}
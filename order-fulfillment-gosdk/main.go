@@ -7,6 +7,8 @@ import (
 	"fmt"
 	"log"
 	"math"
+	"sort"
+	"time"
 
 	"github.com/nextmv-io/go-highs"
 	"github.com/nextmv-io/go-mip"
@@ -27,17 +29,34 @@ type input struct {
 	Items                           []item                                     `json:"items"`
 	DistributionCenters             []distributionCenter                       `json:"distribution_centers"`
 	CarrierCapacities               map[string]map[string]float64              `json:"carrier_capacities"`
+	CarrierWeightCapacities         map[string]map[string]float64              `json:"carrier_weight_capacities,omitempty"`
+	CarrierMaxCartons               map[string]map[string]float64              `json:"carrier_max_cartons,omitempty"`
 	CarrierDeliveryCosts            map[string]map[string]map[string][]float64 `json:"carrier_delivery_costs"`
 	CartonVolume                    float64                                    `json:"carton_volume"`
 	CarrierDimensionalWeightFactors map[string]float64                         `json:"carrier_dimensional_weight_factors"`
+	CarrierTransitDays              map[string]map[string]int                  `json:"carrier_transit_days,omitempty"`
+	CarrierFixedCosts               map[string]map[string]float64              `json:"carrier_fixed_costs,omitempty"`
+	CarrierEmissionFactors          map[string]map[string]float64              `json:"carrier_emission_factors,omitempty"`
 }
 
-// An item has a unique ID, an ordered quantity and a volume.
+// An item has a unique ID, an ordered quantity and a volume. Optionally, an
+// item can define its own carton volume which overrides the global one and the
+// maximum number of transit days to meet the promised delivery date. Items
+// that are sold by weight, e.g. bulk coffee, are divisible and can be shipped
+// in fractional quantities. An item can name a preferred distribution
+// center, e.g. the one it is fastest to pick from. The priority scales the
+// penalty of leaving units of the item unfulfilled.
 type item struct {
-	ItemID     string  `json:"item_id"`
-	Quantity   float64 `json:"quantity"`
-	UnitVolume float64 `json:"unit_volume"`
-	UnitWeight float64 `json:"unit_weight"`
+	ItemID         string  `json:"item_id"`
+	Quantity       float64 `json:"quantity"`
+	Divisible      bool    `json:"divisible,omitempty"`
+	UnitVolume     float64 `json:"unit_volume"`
+	UnitWeight     float64 `json:"unit_weight"`
+	CartonVolume   float64 `json:"carton_volume,omitempty"`
+	MaxTransitDays int     `json:"max_transit_days,omitempty"`
+
+	PreferredDistributionCenterID string `json:"preferred_distribution_center_id,omitempty"`
+	Priority                      int    `json:"priority,omitempty"`
 }
 
 // ID is implemented to fulfill the model.Identifier interface.
@@ -45,16 +64,67 @@ func (i item) ID() string {
 	return i.ItemID
 }
 
+// isDivisible returns true if the item can be shipped in fractional
+// quantities. Items with a fractional quantity are always divisible.
+func (i item) isDivisible() bool {
+	return i.Divisible || i.Quantity != math.Trunc(i.Quantity)
+}
+
+// priority returns the priority of the item, which defaults to 1.
+func (i item) priority() int {
+	if i.Priority == 0 {
+		return 1
+	}
+	return i.Priority
+}
+
+// cartonVolume returns the volume of the cartons the item is packed in. If the
+// item does not define a carton volume, the given default is used.
+func (i item) cartonVolume(defaultVolume float64) float64 {
+	if i.CartonVolume != 0 {
+		return i.CartonVolume
+	}
+	return defaultVolume
+}
+
+// A distribution center holds inventory and handles cartons at a cost. The
+// number of cartons it can handle is limited by its handling capacity, a
+// capacity of 0 means it is uncapacitated. If handling tiers are given, the
+// rate per carton depends on the total number of cartons handled and replaces
+// the flat handling cost.
 type distributionCenter struct {
-	DistributionCenterID string         `json:"distribution_center_id"`
-	Inventory            map[string]int `json:"inventory"`
-	HandlingCost         float64        `json:"handling_cost"`
+	DistributionCenterID string             `json:"distribution_center_id"`
+	Inventory            map[string]float64 `json:"inventory"`
+	HandlingCost         float64            `json:"handling_cost"`
+	HandlingCapacity     float64            `json:"handling_capacity,omitempty"`
+	HandlingTiers        []handlingTier     `json:"handling_tiers,omitempty"`
+}
+
+// A handlingTier applies its rate to all cartons handled at a distribution
+// center if their number is at most UpToCartons and above the limit of the
+// previous tier. Cartons beyond the last tier are handled at its rate.
+type handlingTier struct {
+	UpToCartons float64 `json:"up_to_cartons"`
+	Rate        float64 `json:"rate"`
 }
 
 func (i distributionCenter) ID() string {
 	return i.DistributionCenterID
 }
 
+// handlingRate returns the rate per carton if the given handling tier is
+// selected. The index after the last tier denotes the cartons beyond it.
+// Without handling tiers the flat handling cost is returned.
+func (i distributionCenter) handlingRate(tier int) float64 {
+	if len(i.HandlingTiers) == 0 {
+		return i.HandlingCost
+	}
+	if tier >= len(i.HandlingTiers) {
+		return i.HandlingTiers[len(i.HandlingTiers)-1].Rate
+	}
+	return i.HandlingTiers[tier].Rate
+}
+
 type carrier struct {
 	DistributionCenter distributionCenter `json:"distribution_center"`
 	Carrier            string             `json:"carrier"`
@@ -64,66 +134,204 @@ func (i carrier) ID() string {
 	return i.DistributionCenter.DistributionCenterID + "-" + i.Carrier
 }
 
+// An assignment ships an item from a distribution center with a carrier.
+// Quantity is the quantity shipped, it is only set for the assignments of a
+// solution.
 type assignment struct {
 	Item               item               `json:"item"`
 	DistributionCenter distributionCenter `json:"distribution_center"`
 	Carrier            string             `json:"carrier"`
-	Quantity           int                `json:"quantity"`
+	Quantity           float64            `json:"quantity"`
 }
 
 func (i assignment) ID() string {
-	return i.Item.ItemID + "-" + i.DistributionCenter.DistributionCenterID + "-" + i.Carrier + "-" + fmt.Sprint(i.Quantity)
+	return i.Item.ItemID + "-" + i.DistributionCenter.DistributionCenterID + "-" + i.Carrier
+}
+
+// maxQuantity returns the quantity that can be shipped with the assignment at
+// most, which is the ordered quantity limited by the inventory. Only whole
+// units can be shipped of items that are not divisible.
+func (i assignment) maxQuantity() float64 {
+	quantity := math.Min(i.Item.Quantity, i.DistributionCenter.Inventory[i.Item.ItemID])
+	if !i.Item.isDivisible() {
+		quantity = math.Floor(quantity)
+	}
+	return quantity
 }
 
 type assignmentOutput struct {
-	ItemID               string `json:"item_id"`
-	Quantity             int    `json:"quantity"`
-	DistributionCenterID string `json:"distribution_center_id"`
-	CarrierID            string `json:"carrier_id"`
+	ItemID               string  `json:"item_id"`
+	Quantity             float64 `json:"quantity"`
+	DistributionCenterID string  `json:"distribution_center_id,omitempty"`
+	CarrierID            string  `json:"carrier_id,omitempty"`
+	// Priority is the priority of the item, it is only given for unfulfilled
+	// quantities.
+	Priority int `json:"priority,omitempty"`
 }
 
 // The options for the solver.
 type options struct {
-	Solve mip.SolveOptions `json:"solve,omitempty"`
+	Items struct {
+		Filter []string `json:"filter,omitempty" usage:"only solve for the given item IDs (comma separated)"`
+	} `json:"items,omitempty"`
+	Statistics struct {
+		RateSensitivity bool `json:"rate_sensitivity" usage:"report the sensitivity of the cost to carrier rates"`
+	} `json:"statistics,omitempty"`
+	Format struct {
+		AllocationPlan bool `json:"allocation_plan" usage:"add the assignments grouped by carrier and DC"`
+	} `json:"format,omitempty"`
+	Weights struct {
+		Delivery float64 `json:"delivery" default:"1" usage:"weight of the delivery costs in the objective"`
+		Handling float64 `json:"handling" default:"1" usage:"weight of the handling costs in the objective"`
+	} `json:"weights"`
+	Build struct {
+		Timeout time.Duration `json:"timeout" usage:"abort building the model after this duration (0 = no limit)"`
+	} `json:"build"`
+	Precision          int          `json:"precision" default:"2" usage:"decimal places of output values (-1 = all)"`
+	EmissionWeight     float64      `json:"emission_weight" usage:"weight of the CO2 emissions in the objective"`
+	DCUsagePenalty     float64      `json:"dc_usage_penalty" usage:"penalty per distribution center used"`
+	SplitPenalty       float64      `json:"split_penalty" usage:"penalty per extra distribution center of an item"`
+	PreferenceBonus    float64      `json:"preference_bonus" usage:"reward per unit sourced from its preferred DC"`
+	UnfulfilledPenalty float64      `json:"unfulfilled_penalty" default:"10000" usage:"penalty per unit not fulfilled"`
+	CSVPath            string       `json:"csv_path,omitempty" usage:"write the costs per DC and carrier to a CSV"`
+	ExportModelPath    string       `json:"export_model_path,omitempty" usage:"write the model to a .lp or .mps file"`
+	Solve              solveOptions `json:"solve,omitempty"`
+}
+
+// solveOptions are the options of the solver. Unlike mip.SolveOptions, the
+// relative gap defaults to 0, so that the cheapest fulfillment of the order is
+// proven optimal instead of stopping at one that is close to it.
+type solveOptions struct {
+	Duration  time.Duration `json:"duration" default:"30s" usage:"maximum duration of the solver"`
+	Verbosity mip.Verbosity `json:"verbosity" default:"off" usage:"{off, low, medium, high} verbosity of the solver"`
+	MIP       struct {
+		Gap struct {
+			Absolute float64 `json:"absolute" default:"0.000001" usage:"absolute gap at which to stop"`
+			Relative float64 `json:"relative" usage:"relative gap at which to stop (0.01 = 1%)"`
+		} `json:"gap"`
+	} `json:"mip"`
+	Control mip.ControlOptions `json:"control" usage:"solver-specific control options"`
 }
 
-func computeAssignments(i input) []assignment {
+// mip returns the options as the solve options of go-mip.
+func (o solveOptions) mip() mip.SolveOptions {
+	solveOptions := mip.SolveOptions{
+		Duration:  o.Duration,
+		Verbosity: o.Verbosity,
+		Control:   o.Control,
+	}
+	solveOptions.MIP.Gap.Absolute = o.MIP.Gap.Absolute
+	solveOptions.MIP.Gap.Relative = o.MIP.Gap.Relative
+
+	return solveOptions
+}
+
+// filterItems restricts the items of the input to the given item IDs. All
+// distribution center and carrier data is kept as is.
+func filterItems(i input, ids []string) (input, error) {
+	if len(ids) == 0 {
+		return i, nil
+	}
+
+	items := make(map[string]item, len(i.Items))
+	for _, it := range i.Items {
+		items[it.ItemID] = it
+	}
+
+	filtered := make([]item, 0, len(ids))
+	for _, id := range ids {
+		it, ok := items[id]
+		if !ok {
+			return input{}, fmt.Errorf("item filter: unknown item id %q", id)
+		}
+		filtered = append(filtered, it)
+	}
+	i.Items = filtered
+
+	return i, nil
+}
+
+// computeAssignments creates all possible assignments, one per item,
+// distribution center and carrier. Distribution centers without inventory of
+// the item and distribution center carrier combinations whose transit time
+// exceeds the maximum transit days of an item are excluded. The construction
+// is aborted once the build timeout is exceeded.
+func computeAssignments(i input, progress *buildProgress) ([]assignment, error) {
+	progress.stage = "computing assignments"
 	assignments := []assignment{}
 	for _, it := range i.Items {
+		if err := progress.check(); err != nil {
+			return nil, err
+		}
 		for _, dc := range i.DistributionCenters {
-			for c := range i.CarrierCapacities[dc.DistributionCenterID] {
-				for q := 0; q < int(it.Quantity); q++ {
-					newAssignment := assignment{
-						Item:               it,
-						DistributionCenter: dc,
-						Carrier:            c,
-						Quantity:           q + 1,
+			for _, c := range sortedKeys(i.CarrierCapacities[dc.DistributionCenterID]) {
+				if it.MaxTransitDays > 0 && i.CarrierTransitDays[dc.DistributionCenterID][c] > it.MaxTransitDays {
+					continue
+				}
+				newAssignment := assignment{
+					Item:               it,
+					DistributionCenter: dc,
+					Carrier:            c,
+				}
+				if newAssignment.maxQuantity() <= 0 {
+					continue
+				}
+				assignments = append(assignments, newAssignment)
+				progress.assignments++
+				// Checking the time is not free, so we only do it every now
+				// and then.
+				if progress.assignments%1024 == 0 {
+					if err := progress.check(); err != nil {
+						return nil, err
 					}
-					assignments = append(assignments, newAssignment)
 				}
 			}
 		}
+		progress.items++
 	}
-	return assignments
+	return assignments, nil
 }
 
+// provider is the solver provider that solves the model, reported in the
+// statistics.
+const provider = "highs"
+
 func solver(_ context.Context, i input, opts options) (schema.Output, error) {
+	// Make sure the input is consistent before building the model.
+	if err := validate(i); err != nil {
+		return schema.Output{}, fmt.Errorf("invalid input: %w", err)
+	}
+
+	// Restrict the model to a subset of the items, if requested.
+	i, err := filterItems(i, opts.Items.Filter)
+	if err != nil {
+		return schema.Output{}, err
+	}
+
 	// We start by creating a MIP model.
 	m := mip.NewModel()
 
 	// used in constraints as a bound
 	totalWeight := 0.0
+	totalCartons := 0.0
 	for _, order := range i.Items {
 		totalWeight += order.Quantity * order.UnitWeight
+		totalCartons += order.Quantity * order.UnitVolume / order.cartonVolume(i.CartonVolume)
 	}
 
+	// Keep track of the model construction to abort it if it takes too long.
+	progress := newBuildProgress(opts.Build.Timeout, len(i.Items))
+
 	// create assignments (item, dc, carrier combinations)
-	assignments := computeAssignments(i)
+	assignments, err := computeAssignments(i, progress)
+	if err != nil {
+		return schema.Output{}, err
+	}
 
 	// create some helping data structures
 	distributionCenterCarrierCombinations := []carrier{}
 	for _, dc := range i.DistributionCenters {
-		for c := range i.CarrierCapacities[dc.DistributionCenterID] {
+		for _, c := range sortedKeys(i.CarrierCapacities[dc.DistributionCenterID]) {
 			newCarrier := carrier{
 				DistributionCenter: dc,
 				Carrier:            c,
@@ -132,6 +340,7 @@ func solver(_ context.Context, i input, opts options) (schema.Output, error) {
 		}
 	}
 
+	progress.stage = "grouping assignments"
 	itemToAssignments := make(map[string][]assignment, len(i.Items))
 	distributionCenterToCarrierToAssignments := make(map[string]map[string][]assignment, len(i.DistributionCenters))
 	for _, as := range assignments {
@@ -150,21 +359,36 @@ func solver(_ context.Context, i input, opts options) (schema.Output, error) {
 		distributionCenterToCarrierToAssignments[as.DistributionCenter.DistributionCenterID][as.Carrier] =
 			append(distributionCenterToCarrierToAssignments[as.DistributionCenter.DistributionCenterID][as.Carrier], as)
 	}
+	if err := progress.check(); err != nil {
+		return schema.Output{}, err
+	}
+
+	progress.stage = "building the model"
 
 	// x is a multimap representing a set of variables. It is initialized with a
 	// create function and, in this case one set of elements. The elements can
 	// be used as an index to the multimap. To retrieve a variable, call
-	// x.Get(element) where element is an element from the index set.
+	// x.Get(element) where element is an element from the index set. Every
+	// variable holds the quantity shipped with an assignment, it is continuous
+	// for divisible items and integer otherwise.
 	x := model.NewMultiMap(
-		func(...assignment) mip.Bool {
-			return m.NewBool()
+		func(a ...assignment) mip.Var {
+			if a[0].Item.isDivisible() {
+				return m.NewFloat(0, a[0].maxQuantity())
+			}
+			return m.NewInt(0, int64(a[0].maxQuantity()))
 		}, assignments)
 
 	// create another multimap which will hold the info about the number of
-	// cartons at each distribution center.
+	// cartons at each distribution center. A carrier may cap the number of
+	// cartons it accepts, which bounds the variable.
 	cartons := model.NewMultiMap(
-		func(...carrier) mip.Float {
-			return m.NewFloat(0.0, 1000.0)
+		func(c ...carrier) mip.Float {
+			maxCartons := 1000.0
+			if limit, ok := i.CarrierMaxCartons[c[0].DistributionCenter.DistributionCenterID][c[0].Carrier]; ok {
+				maxCartons = math.Min(maxCartons, limit)
+			}
+			return m.NewFloat(0.0, maxCartons)
 		}, distributionCenterCarrierCombinations)
 
 	// multimap for the total volume for each distribution center carrier
@@ -213,6 +437,24 @@ func solver(_ context.Context, i input, opts options) (schema.Output, error) {
 		}
 	}
 
+	// distribution center -> handling tier index -> bool var. Only
+	// distribution centers with handling tiers are part of the map.
+	handlingTierVariables := make(map[string]map[int]mip.Bool)
+	// distribution center -> handling tier index -> cartons handled in the
+	// tier, which are 0 unless the tier is selected.
+	tierCartons := make(map[string]map[int]mip.Float)
+	for _, dc := range i.DistributionCenters {
+		if len(dc.HandlingTiers) == 0 {
+			continue
+		}
+		handlingTierVariables[dc.DistributionCenterID] = make(map[int]mip.Bool)
+		tierCartons[dc.DistributionCenterID] = make(map[int]mip.Float)
+		for k := 0; k < len(dc.HandlingTiers)+1; k++ {
+			handlingTierVariables[dc.DistributionCenterID][k] = m.NewBool()
+			tierCartons[dc.DistributionCenterID][k] = m.NewFloat(0.0, math.Ceil(totalCartons))
+		}
+	}
+
 	// multimap for the delivery costs for each distribution center carrier
 	// combination.
 	deliveryCosts := model.NewMultiMap(
@@ -223,27 +465,56 @@ func solver(_ context.Context, i input, opts options) (schema.Output, error) {
 	// We want to minimize the costs for fulfilling the order.
 	m.Objective().SetMinimize()
 
-	// Fulfilment constraint -> ensure all items are assigned.
+	// multimap for the unfulfilled quantity of each item. It keeps the model
+	// feasible in case items cannot be sourced.
+	unfulfilled := model.NewMultiMap(
+		func(items ...item) mip.Float {
+			return m.NewFloat(0.0, items[0].Quantity)
+		}, i.Items)
+
+	// Fulfilment constraint -> ensure all items are assigned, unless they are
+	// reported as unfulfilled.
 	for _, item := range i.Items {
 		fulfillment := m.NewConstraint(
 			mip.Equal,
 			item.Quantity,
 		)
+		fulfillment.NewTerm(1.0, unfulfilled.Get(item))
 		for _, a := range itemToAssignments[item.ItemID] {
-			fulfillment.NewTerm(float64(a.Quantity), x.Get(a))
+			fulfillment.NewTerm(1.0, x.Get(a))
 		}
 	}
 
 	// Carrier capacity constraint -> consider the carrier capacities in the
 	// solution; carrier capacity is considered in volume.
-	for dcID, dc := range distributionCenterToCarrierToAssignments {
-		for cID, list := range dc {
+	for _, dcID := range sortedKeys(distributionCenterToCarrierToAssignments) {
+		dc := distributionCenterToCarrierToAssignments[dcID]
+		for _, cID := range sortedKeys(dc) {
+			list := dc[cID]
 			carrier := m.NewConstraint(
 				mip.LessThanOrEqual,
 				i.CarrierCapacities[dcID][cID],
 			)
 			for _, as := range list {
-				carrier.NewTerm(as.Item.UnitVolume*as.Item.Quantity, x.Get(as))
+				carrier.NewTerm(as.Item.UnitVolume, x.Get(as))
+			}
+		}
+	}
+
+	// Carrier weight capacity constraint -> a carrier may also limit the
+	// weight it picks up at a distribution center. Without a weight capacity
+	// the weight is unbounded.
+	for _, dcID := range sortedKeys(distributionCenterToCarrierToAssignments) {
+		dc := distributionCenterToCarrierToAssignments[dcID]
+		for _, cID := range sortedKeys(dc) {
+			list := dc[cID]
+			capacity, ok := i.CarrierWeightCapacities[dcID][cID]
+			if !ok {
+				continue
+			}
+			carrier := m.NewConstraint(mip.LessThanOrEqual, capacity)
+			for _, as := range list {
+				carrier.NewTerm(as.Item.UnitWeight, x.Get(as))
 			}
 		}
 	}
@@ -254,19 +525,20 @@ func solver(_ context.Context, i input, opts options) (schema.Output, error) {
 		for _, dc := range i.DistributionCenters {
 			inventory := m.NewConstraint(
 				mip.LessThanOrEqual,
-				float64(dc.Inventory[item.ItemID]),
+				dc.Inventory[item.ItemID],
 			)
 			for _, a := range itemToAssignments[item.ItemID] {
 				if a.DistributionCenter.DistributionCenterID == dc.DistributionCenterID {
-					inventory.NewTerm(float64(a.Quantity), x.Get(a))
+					inventory.NewTerm(1.0, x.Get(a))
 				}
 			}
 		}
 	}
 
 	/* carton computation -> look at every distribution center and accumulate
-	the volume of all the assigned items, use the carton volume from the input to
-	compute the number of cartons that are necessary.
+	the volume of all the assigned items, use the carton volume from the input
+	(or the item specific one, if given) to compute the number of cartons that
+	are necessary. Handling costs are based on these cartons.
 	volume computation -> compute the volume for each distribution center -
 	carrier combination.
 	weight computation -> compute the weight for each
@@ -293,9 +565,62 @@ func solver(_ context.Context, i input, opts options) (schema.Output, error) {
 		for _, a := range assignments {
 			if a.DistributionCenter.DistributionCenterID == dc.DistributionCenter.DistributionCenterID &&
 				a.Carrier == dc.Carrier {
-				cartonConstr.NewTerm(a.Item.UnitVolume*float64(a.Quantity)*1/i.CartonVolume, x.Get(a))
-				volumeConstr.NewTerm(a.Item.UnitVolume*float64(a.Quantity), x.Get(a))
-				weightConstr.NewTerm(a.Item.UnitWeight*float64(a.Quantity), x.Get(a))
+				cartonConstr.NewTerm(a.Item.UnitVolume*1/a.Item.cartonVolume(i.CartonVolume), x.Get(a))
+				volumeConstr.NewTerm(a.Item.UnitVolume, x.Get(a))
+				weightConstr.NewTerm(a.Item.UnitWeight, x.Get(a))
+			}
+		}
+	}
+
+	/* handling capacity constraint -> the cartons of all carriers at a
+	distribution center must not exceed its handling capacity. */
+	for _, dc := range i.DistributionCenters {
+		if dc.HandlingCapacity <= 0 {
+			continue
+		}
+		handlingConstr := m.NewConstraint(
+			mip.LessThanOrEqual,
+			dc.HandlingCapacity,
+		)
+		for _, combi := range distributionCenterCarrierCombinations {
+			if combi.DistributionCenter.DistributionCenterID == dc.DistributionCenterID {
+				handlingConstr.NewTerm(1.0, cartons.Get(combi))
+			}
+		}
+	}
+
+	/* handling tiers -> a single handling tier is selected per distribution
+	center. The cartons handled at the distribution center are attributed to
+	the selected tier and must lie within its limits. */
+	for _, dc := range i.DistributionCenters {
+		if len(dc.HandlingTiers) == 0 {
+			continue
+		}
+		tiersConstraint := m.NewConstraint(mip.Equal, 1.0)
+		cartonsConstraint := m.NewConstraint(mip.Equal, 0.0)
+		for _, combi := range distributionCenterCarrierCombinations {
+			if combi.DistributionCenter.DistributionCenterID == dc.DistributionCenterID {
+				cartonsConstraint.NewTerm(-1.0, cartons.Get(combi))
+			}
+		}
+		for k := 0; k < len(dc.HandlingTiers)+1; k++ {
+			selected := handlingTierVariables[dc.DistributionCenterID][k]
+			handled := tierCartons[dc.DistributionCenterID][k]
+			tiersConstraint.NewTerm(1.0, selected)
+			cartonsConstraint.NewTerm(1.0, handled)
+
+			upper := math.Ceil(totalCartons)
+			if k < len(dc.HandlingTiers) {
+				upper = dc.HandlingTiers[k].UpToCartons
+			}
+			upperConstraint := m.NewConstraint(mip.LessThanOrEqual, 0.0)
+			upperConstraint.NewTerm(1.0, handled)
+			upperConstraint.NewTerm(-upper, selected)
+
+			if k > 0 {
+				lowerConstraint := m.NewConstraint(mip.GreaterThanOrEqual, 0.0)
+				lowerConstraint.NewTerm(1.0, handled)
+				lowerConstraint.NewTerm(-dc.HandlingTiers[k-1].UpToCartons, selected)
 			}
 		}
 	}
@@ -335,7 +660,7 @@ func solver(_ context.Context, i input, opts options) (schema.Output, error) {
 	/* Only one weight tier -> for each carrier, only a single weight tier can
 	be selected. */
 	for _, dc := range i.DistributionCenters {
-		for c := range i.CarrierDimensionalWeightFactors {
+		for _, c := range sortedKeys(i.CarrierDimensionalWeightFactors) {
 			tiersConstraint := m.NewConstraint(mip.Equal, 1.0)
 			weightTiersLength := len(i.CarrierDeliveryCosts[dc.DistributionCenterID][c]["weight_tiers"])
 			for k := 0; k < weightTiersLength+1; k++ {
@@ -407,39 +732,147 @@ func solver(_ context.Context, i input, opts options) (schema.Output, error) {
 		}
 	}
 
-	/* objective function = handling costs + delivery costs */
+	/* objective function = handling costs + delivery costs, each multiplied
+	by its weight */
 	/* handling costs: cost is based on number of cartons that need to be
-	handled at a distribution center */
+	handled at a distribution center, at the rate of the selected handling tier
+	if the distribution center has handling tiers */
 	/* delivery costs: cost is based on number of cartons that need to be
 	transported */
 	for _, combination := range distributionCenterCarrierCombinations {
-		m.Objective().NewTerm(1.0, deliveryCosts.Get(combination))
-		m.Objective().NewTerm(combination.DistributionCenter.HandlingCost, cartons.Get(combination)) // handling costs
+		m.Objective().NewTerm(opts.Weights.Delivery, deliveryCosts.Get(combination))
+		if len(combination.DistributionCenter.HandlingTiers) > 0 {
+			continue
+		}
+		m.Objective().NewTerm(
+			opts.Weights.Handling*combination.DistributionCenter.HandlingCost,
+			cartons.Get(combination),
+		) // handling costs
+	}
+	for _, dc := range i.DistributionCenters {
+		for _, k := range sortedKeys(tierCartons[dc.DistributionCenterID]) {
+			handled := tierCartons[dc.DistributionCenterID][k]
+			m.Objective().NewTerm(opts.Weights.Handling*dc.handlingRate(k), handled)
+		}
 	}
 
-	// We create a solver using the 'highs' provider.
-	solver := highs.NewSolver(m)
+	/* emissions -> the CO2 emissions of a distribution center carrier
+	combination are proportional to its billable weight. */
+	if opts.EmissionWeight > 0 {
+		for _, combi := range distributionCenterCarrierCombinations {
+			factor := i.CarrierEmissionFactors[combi.DistributionCenter.DistributionCenterID][combi.Carrier]
+			if factor > 0 {
+				m.Objective().NewTerm(opts.EmissionWeight*factor, billableWeights.Get(combi))
+			}
+		}
+	}
 
-	// We create the solve options we will use.
-	solveOptions := mip.SolveOptions{}
+	/* unfulfilled penalty -> every unit of an item that cannot be sourced is
+	penalized, the penalty dominates the actual costs. It is scaled by the
+	priority of the item, so that high-priority items are fulfilled first. */
+	for _, item := range i.Items {
+		m.Objective().NewTerm(opts.UnfulfilledPenalty*float64(item.priority()), unfulfilled.Get(item))
+	}
 
-	// Limit the solve to a maximum duration.
-	solveOptions.Duration = opts.Solve.Duration
-	// Set the relative gap to 0% (highs' default is 5%).
-	solveOptions.MIP.Gap.Relative = 0.0
+	/* split shipment penalty -> every distribution center an item is sourced
+	from beyond the first one is penalized in the objective. */
+	if opts.SplitPenalty > 0 {
+		for _, item := range i.Items {
+			sourced := map[string]mip.Bool{}
+			splits := m.NewFloat(0.0, float64(len(i.DistributionCenters)))
+			// splits >= sum of sourced distribution centers - 1
+			splitConstr := m.NewConstraint(mip.GreaterThanOrEqual, -1.0)
+			splitConstr.NewTerm(1.0, splits)
+			for _, a := range itemToAssignments[item.ItemID] {
+				dcID := a.DistributionCenter.DistributionCenterID
+				if _, ok := sourced[dcID]; !ok {
+					sourced[dcID] = m.NewBool()
+					splitConstr.NewTerm(-1.0, sourced[dcID])
+				}
+				// an assignment can only be used if the item is sourced from
+				// the distribution center.
+				link := m.NewConstraint(mip.LessThanOrEqual, 0.0)
+				link.NewTerm(1.0, x.Get(a))
+				link.NewTerm(-a.maxQuantity(), sourced[dcID])
+			}
+			m.Objective().NewTerm(opts.SplitPenalty, splits)
+		}
+	}
 
-	// Set verbose level to see a more detailed output.
-	solveOptions.Verbosity = mip.Off
+	/* preference bonus -> every unit of an item that is sourced from its
+	preferred distribution center is rewarded. The bonus is meant to be small,
+	so that it only breaks near-ties between distribution centers. */
+	if opts.PreferenceBonus > 0 {
+		for _, a := range assignments {
+			if a.DistributionCenter.DistributionCenterID == a.Item.PreferredDistributionCenterID {
+				m.Objective().NewTerm(-opts.PreferenceBonus, x.Get(a))
+			}
+		}
+	}
+
+	/* distribution center usage penalty -> every distribution center that
+	ships anything for the order is penalized in the objective. This
+	consolidates the order into few distribution centers. */
+	if opts.DCUsagePenalty > 0 {
+		for _, dc := range i.DistributionCenters {
+			active := m.NewBool()
+			carriers := distributionCenterToCarrierToAssignments[dc.DistributionCenterID]
+			for _, c := range sortedKeys(carriers) {
+				for _, a := range carriers[c] {
+					// an assignment can only be used if the distribution
+					// center is active.
+					link := m.NewConstraint(mip.LessThanOrEqual, 0.0)
+					link.NewTerm(1.0, x.Get(a))
+					link.NewTerm(-a.maxQuantity(), active)
+				}
+			}
+			m.Objective().NewTerm(opts.DCUsagePenalty, active)
+		}
+	}
+
+	/* carrier fixed costs -> a carrier charges a flat fee for picking up at a
+	distribution center if any item is shipped with it from there. */
+	for _, combi := range distributionCenterCarrierCombinations {
+		dcID := combi.DistributionCenter.DistributionCenterID
+		fixedCost := i.CarrierFixedCosts[dcID][combi.Carrier]
+		if fixedCost <= 0 {
+			continue
+		}
+		used := m.NewBool()
+		for _, a := range distributionCenterToCarrierToAssignments[dcID][combi.Carrier] {
+			// an assignment can only be used if the carrier is used at the
+			// distribution center.
+			link := m.NewConstraint(mip.LessThanOrEqual, 0.0)
+			link.NewTerm(1.0, x.Get(a))
+			link.NewTerm(-a.maxQuantity(), used)
+		}
+		m.Objective().NewTerm(fixedCost, used)
+	}
+
+	if err := progress.check(); err != nil {
+		return schema.Output{}, err
+	}
 
-	solution, err := solver.Solve(solveOptions)
+	// We create a solver using the 'highs' provider.
+	solver := highs.NewSolver(m)
+
+	// Write the model to disk for debugging, if requested.
+	if opts.ExportModelPath != "" {
+		if err := exportModel(m, opts.ExportModelPath); err != nil {
+			return schema.Output{}, err
+		}
+	}
+
+	solution, err := solver.Solve(opts.Solve.mip())
 	if err != nil {
 		return schema.Output{}, err
 	}
 
-	output, err := format(solution, opts, x, assignments,
+	output, err := format(solution, opts, x, assignments, i.Items, unfulfilled,
 		distributionCenterCarrierCombinations, cartons, volumes,
 		dimensionalWeights, weights, billableWeights,
-		weightTierVariables, deliveryCosts,
+		weightTierVariables, deliveryCosts, i.CarrierFixedCosts, i.CarrierEmissionFactors,
+		handlingTierVariables, i.CarrierMaxCartons,
 	)
 	if err != nil {
 		return schema.Output{}, err
@@ -450,6 +883,7 @@ func solver(_ context.Context, i input, opts options) (schema.Output, error) {
 
 type oflSolution struct {
 	Assignments        []assignmentOutput     `json:"assignments"`
+	Unfulfilled        []assignmentOutput     `json:"unfulfilled"`
 	Cartons            map[string]float64     `json:"cartons"`
 	Status             string                 `json:"status"`
 	Value              float64                `json:"value"`
@@ -459,18 +893,65 @@ type oflSolution struct {
 	BillableWeights    map[string]float64     `json:"billable_weights"`
 	WeightTiers        map[string]map[int]int `json:"weight_tiers"`
 	DeliveryCosts      map[string]float64     `json:"delivery_costs"`
+	// Utilization is the share of the handling capacity used per distribution
+	// center. Only distribution centers with a handling capacity are listed.
+	Utilization map[string]float64 `json:"utilization,omitempty"`
+	// HandlingTiers holds the index of the selected handling tier per
+	// distribution center. Only distribution centers with handling tiers are
+	// listed.
+	HandlingTiers map[string]int `json:"handling_tiers,omitempty"`
+	// AllocationPlan nests the assignments under carrier and distribution
+	// center, it is only given if requested.
+	AllocationPlan []carrierAllocation `json:"allocation_plan,omitempty"`
+	// ActiveCarriers holds the fixed cost of every distribution center carrier
+	// combination that ships anything.
+	ActiveCarriers map[string]float64 `json:"active_carriers"`
+}
+
+// customRunStatistics are the custom statistics of the run.
+type customRunStatistics struct {
+	// Gap echoes the relative gap requested with -solve.mip.gap.relative once
+	// the solution is optimal, i.e. the solver reached it. go-mip does not
+	// expose the gap that the solver achieved, which may be smaller.
+	Gap *float64 `json:"gap,omitempty"`
 }
 
 type customResultStatistics struct {
 	DeliveryCosts float64 `json:"delivery_costs"`
 	HandlingCosts float64 `json:"handling_costs"`
+	FixedCosts    float64 `json:"fixed_costs"`
+	// Emissions are the CO2 emissions in kg of all shipments.
+	Emissions   float64  `json:"emissions"`
+	ItemsFilter []string `json:"items_filter,omitempty"`
+	Provider    string   `json:"provider"`
+	Splits      int      `json:"splits"`
+	// ActiveDistributionCenters is the number of distribution centers that
+	// ship anything for the order.
+	ActiveDistributionCenters int `json:"active_distribution_centers"`
+	// PreferredUnitsHonored and PreferredUnitsNotHonored are the units of
+	// items with a preferred distribution center that are sourced from it
+	// and from another distribution center.
+	PreferredUnitsHonored    float64 `json:"preferred_units_honored"`
+	PreferredUnitsNotHonored float64 `json:"preferred_units_not_honored"`
+	// BindingCartonCaps lists the distribution center carrier combinations
+	// that ship as many cartons as their carrier accepts.
+	BindingCartonCaps []string `json:"binding_carton_caps,omitempty"`
+	// Weights are the weights of the delivery and handling costs used in the
+	// objective.
+	Weights map[string]float64 `json:"weights"`
+	// RateSensitivity approximates the change of the total cost per unit
+	// change of the weight rate of a distribution center carrier combination
+	// by the billable weight shipped with it.
+	RateSensitivity map[string]float64 `json:"rate_sensitivity,omitempty"`
 }
 
 func format(
 	solution mip.Solution,
 	opts options,
-	x model.MultiMap[mip.Bool, assignment],
+	x model.MultiMap[mip.Var, assignment],
 	assignments []assignment,
+	items []item,
+	unfulfilled model.MultiMap[mip.Float, item],
 	carriers []carrier,
 	cartons model.MultiMap[mip.Float, carrier],
 	volumes model.MultiMap[mip.Float, carrier],
@@ -479,16 +960,26 @@ func format(
 	billableWeights model.MultiMap[mip.Float, carrier],
 	weightTierVariables map[string]map[string]map[int]mip.Bool,
 	deliveryCosts model.MultiMap[mip.Float, carrier],
+	carrierFixedCosts map[string]map[string]float64,
+	carrierEmissionFactors map[string]map[string]float64,
+	handlingTierVariables map[string]map[int]mip.Bool,
+	carrierMaxCartons map[string]map[string]float64,
 ) (output schema.Output, err error) {
-	o := schema.NewOutput(opts, []mip.Solution{solution})
+	o := schema.NewOutput[any](opts)
 
 	stats := statistics.NewStatistics()
 	result := statistics.Result{}
 	run := statistics.Run{}
 
-	t := round(solution.RunTime().Seconds())
+	t := round(solution.RunTime().Seconds(), opts.Precision)
 	run.Duration = &t
 	result.Duration = &t
+	runStatistics := customRunStatistics{}
+	if solution != nil && solution.IsOptimal() {
+		gap := opts.Solve.MIP.Gap.Relative
+		runStatistics.Gap = &gap
+	}
+	run.Custom = runStatistics
 
 	oflSolution := oflSolution{}
 	oflSolution.Status = "infeasible"
@@ -500,13 +991,17 @@ func format(
 			oflSolution.Status = "suboptimal"
 		}
 
-		oflSolution.Value = round(solution.ObjectiveValue())
-		val := statistics.Float64(round(solution.ObjectiveValue()))
+		oflSolution.Value = round(solution.ObjectiveValue(), opts.Precision)
+		val := statistics.Float64(round(solution.ObjectiveValue(), opts.Precision))
 		result.Value = &val
 
 		assignmentList := make([]assignmentOutput, 0)
+		selected := make([]assignment, 0)
 		for _, assignment := range assignments {
-			if solution.Value(x.Get(assignment)) > 0.5 {
+			quantity := round(solution.Value(x.Get(assignment)), opts.Precision)
+			if quantity > 0 {
+				assignment.Quantity = quantity
+				selected = append(selected, assignment)
 				ao := assignmentOutput{
 					ItemID:               assignment.Item.ItemID,
 					Quantity:             assignment.Quantity,
@@ -519,8 +1014,64 @@ func format(
 
 		oflSolution.Assignments = assignmentList
 
+		totalFixedCosts := 0.0
+		oflSolution.ActiveCarriers = make(map[string]float64)
+		for _, a := range selected {
+			combination := carrier{DistributionCenter: a.DistributionCenter, Carrier: a.Carrier}
+			if _, ok := oflSolution.ActiveCarriers[combination.ID()]; ok {
+				continue
+			}
+			fixedCost := carrierFixedCosts[a.DistributionCenter.DistributionCenterID][a.Carrier]
+			oflSolution.ActiveCarriers[combination.ID()] = fixedCost
+			totalFixedCosts += fixedCost
+		}
+
+		oflSolution.Unfulfilled = make([]assignmentOutput, 0)
+		for _, item := range items {
+			quantity := round(solution.Value(unfulfilled.Get(item)), opts.Precision)
+			if quantity > 0 {
+				oflSolution.Unfulfilled = append(oflSolution.Unfulfilled, assignmentOutput{
+					ItemID:   item.ItemID,
+					Quantity: quantity,
+					Priority: item.priority(),
+				})
+			}
+		}
+
+		// count the distribution centers used beyond the first one per item.
+		sourced := make(map[string]map[string]bool)
+		for _, ao := range assignmentList {
+			if _, ok := sourced[ao.ItemID]; !ok {
+				sourced[ao.ItemID] = make(map[string]bool)
+			}
+			sourced[ao.ItemID][ao.DistributionCenterID] = true
+		}
+		// count the units of items with a preferred distribution center that
+		// are sourced from it and from elsewhere.
+		preferredUnitsHonored := 0.0
+		preferredUnitsNotHonored := 0.0
+		for _, a := range selected {
+			switch a.Item.PreferredDistributionCenterID {
+			case "":
+			case a.DistributionCenter.DistributionCenterID:
+				preferredUnitsHonored += a.Quantity
+			default:
+				preferredUnitsNotHonored += a.Quantity
+			}
+		}
+
+		splits := 0
+		activeDCs := make(map[string]bool)
+		for _, dcs := range sourced {
+			splits += len(dcs) - 1
+			for dcID := range dcs {
+				activeDCs[dcID] = true
+			}
+		}
+
 		totalDeliveryCosts := 0.0
 		totalHandlingCosts := 0.0
+		totalEmissions := 0.0
 
 		oflSolution.Cartons = make(map[string]float64)
 		oflSolution.Volumes = make(map[string]float64)
@@ -529,6 +1080,20 @@ func format(
 		oflSolution.BillableWeights = make(map[string]float64)
 		oflSolution.WeightTiers = make(map[string]map[int]int)
 		oflSolution.DeliveryCosts = make(map[string]float64)
+		rateSensitivity := make(map[string]float64)
+		handledCartons := make(map[string]float64)
+		handlingCosts := make(map[string]float64)
+		bindingCartonCaps := make([]string, 0)
+		for dcID, tiers := range handlingTierVariables {
+			if oflSolution.HandlingTiers == nil {
+				oflSolution.HandlingTiers = make(map[string]int)
+			}
+			for k, tier := range tiers {
+				if solution.Value(tier) > 0.5 {
+					oflSolution.HandlingTiers[dcID] = k
+				}
+			}
+		}
 		for _, c := range carriers {
 			cs := solution.Value(cartons.Get(c))
 			v := solution.Value(volumes.Get(c))
@@ -536,28 +1101,88 @@ func format(
 			w := solution.Value(weights.Get(c))
 			bw := solution.Value(billableWeights.Get(c))
 			delc := solution.Value(deliveryCosts.Get(c))
-			handc := c.DistributionCenter.HandlingCost * cs
+			handc := c.DistributionCenter.handlingRate(
+				oflSolution.HandlingTiers[c.DistributionCenter.DistributionCenterID],
+			) * cs
 
 			totalDeliveryCosts += delc
 			totalHandlingCosts += handc
-
-			oflSolution.Cartons[c.DistributionCenter.DistributionCenterID+"-"+c.Carrier] = cs
-			oflSolution.Volumes[c.DistributionCenter.DistributionCenterID+"-"+c.Carrier] = v
-			oflSolution.DimensionalWeights[c.DistributionCenter.DistributionCenterID+"-"+c.Carrier] = dw
-			oflSolution.Weights[c.DistributionCenter.DistributionCenterID+"-"+c.Carrier] = w
-			oflSolution.BillableWeights[c.DistributionCenter.DistributionCenterID+"-"+c.Carrier] = bw
-			oflSolution.DeliveryCosts[c.DistributionCenter.DistributionCenterID+"-"+c.Carrier] = delc
+			handledCartons[c.DistributionCenter.DistributionCenterID] += cs
+			limit, ok := carrierMaxCartons[c.DistributionCenter.DistributionCenterID][c.Carrier]
+			if ok && cs >= limit-1e-6 {
+				bindingCartonCaps = append(bindingCartonCaps, c.ID())
+			}
+			handlingCosts[c.ID()] = handc
+
+			oflSolution.Cartons[c.DistributionCenter.DistributionCenterID+"-"+c.Carrier] = round(cs, opts.Precision)
+			oflSolution.Volumes[c.DistributionCenter.DistributionCenterID+"-"+c.Carrier] = round(v, opts.Precision)
+			oflSolution.DimensionalWeights[c.DistributionCenter.DistributionCenterID+"-"+c.Carrier] = round(dw, opts.Precision)
+			oflSolution.Weights[c.DistributionCenter.DistributionCenterID+"-"+c.Carrier] = round(w, opts.Precision)
+			oflSolution.BillableWeights[c.DistributionCenter.DistributionCenterID+"-"+c.Carrier] = round(bw, opts.Precision)
+			oflSolution.DeliveryCosts[c.DistributionCenter.DistributionCenterID+"-"+c.Carrier] = round(delc, opts.Precision)
+			// the billable weight is derived from the actual weights, as the
+			// variable itself is only bounded by the selected weight tier.
+			rateSensitivity[c.DistributionCenter.DistributionCenterID+"-"+c.Carrier] = round(math.Max(w, dw), opts.Precision)
+			// emissions are based on the same billable weight, which is 0 for
+			// unused combinations.
+			totalEmissions += carrierEmissionFactors[c.DistributionCenter.DistributionCenterID][c.Carrier] *
+				math.Max(w, dw)
 			oflSolution.WeightTiers[c.DistributionCenter.DistributionCenterID+"-"+c.Carrier] = make(map[int]int)
 			for key, tier := range weightTierVariables[c.DistributionCenter.DistributionCenterID][c.Carrier] {
 				oflSolution.WeightTiers[c.DistributionCenter.DistributionCenterID+"-"+c.Carrier][key] = int(solution.Value(tier))
 			}
 		}
 
+		sort.Strings(bindingCartonCaps)
+
+		if opts.Format.AllocationPlan {
+			oflSolution.AllocationPlan = allocationPlan(
+				selected, carriers, oflSolution.DeliveryCosts, handlingCosts, opts.Precision,
+			)
+		}
+
+		for _, c := range carriers {
+			dc := c.DistributionCenter
+			if dc.HandlingCapacity <= 0 {
+				continue
+			}
+			if oflSolution.Utilization == nil {
+				oflSolution.Utilization = make(map[string]float64)
+			}
+			oflSolution.Utilization[dc.DistributionCenterID] = round(
+				handledCartons[dc.DistributionCenterID]/dc.HandlingCapacity, opts.Precision,
+			)
+		}
+
+		// Optionally, write the cost breakdown per distribution center and
+		// carrier for spreadsheets.
+		if opts.CSVPath != "" {
+			if err := writeCSV(opts.CSVPath, oflSolution, carriers); err != nil {
+				return output, err
+			}
+		}
+
 		o.Solutions = append(o.Solutions, oflSolution)
 
 		customResultStatistics := customResultStatistics{
-			DeliveryCosts: round(totalDeliveryCosts),
-			HandlingCosts: round(totalHandlingCosts),
+			DeliveryCosts:             round(totalDeliveryCosts, opts.Precision),
+			HandlingCosts:             round(totalHandlingCosts, opts.Precision),
+			FixedCosts:                round(totalFixedCosts, opts.Precision),
+			Emissions:                 round(totalEmissions, opts.Precision),
+			ItemsFilter:               opts.Items.Filter,
+			Provider:                  provider,
+			Splits:                    splits,
+			ActiveDistributionCenters: len(activeDCs),
+			PreferredUnitsHonored:     round(preferredUnitsHonored, opts.Precision),
+			PreferredUnitsNotHonored:  round(preferredUnitsNotHonored, opts.Precision),
+			BindingCartonCaps:         bindingCartonCaps,
+			Weights: map[string]float64{
+				"delivery": opts.Weights.Delivery,
+				"handling": opts.Weights.Handling,
+			},
+		}
+		if opts.Statistics.RateSensitivity {
+			customResultStatistics.RateSensitivity = rateSensitivity
 		}
 
 		result.Custom = customResultStatistics
@@ -572,8 +1197,12 @@ func format(
 	return o, nil
 }
 
-func round(value float64) float64 {
-	precision := 2
+// round rounds the value to the given number of decimal places. A negative
+// precision keeps the value as is.
+func round(value float64, precision int) float64 {
+	if precision < 0 {
+		return value
+	}
 	ratio := math.Pow(10, float64(precision))
 	round := math.Round(value*ratio) / ratio
 
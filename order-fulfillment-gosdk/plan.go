@@ -0,0 +1,116 @@
+package main
+
+import "sort"
+
+// carrierAllocation groups the assignments of a carrier by distribution
+// center. This matches how carriers invoice the shipments.
+type carrierAllocation struct {
+	CarrierID           string         `json:"carrier_id"`
+	Volume              float64        `json:"volume"`
+	Weight              float64        `json:"weight"`
+	DeliveryCosts       float64        `json:"delivery_costs"`
+	HandlingCosts       float64        `json:"handling_costs"`
+	DistributionCenters []dcAllocation `json:"distribution_centers"`
+}
+
+// dcAllocation holds the items shipped with a carrier from a distribution
+// center.
+type dcAllocation struct {
+	DistributionCenterID string             `json:"distribution_center_id"`
+	Volume               float64            `json:"volume"`
+	Weight               float64            `json:"weight"`
+	DeliveryCosts        float64            `json:"delivery_costs"`
+	HandlingCosts        float64            `json:"handling_costs"`
+	Items                []assignmentOutput `json:"items"`
+}
+
+// allocationPlan nests the selected assignments under carrier and distribution
+// center. The quantities of an item are summed up per group and all values are
+// rounded to the given precision. The costs of a distribution center carrier
+// combination are looked up by its ID. Every combination that is used or
+// causes costs is part of the plan, so that the subtotals add up to the total
+// costs.
+func allocationPlan(
+	selected []assignment,
+	carriers []carrier,
+	deliveryCosts map[string]float64,
+	handlingCosts map[string]float64,
+	precision int,
+) []carrierAllocation {
+	groups := map[string]map[string]*dcAllocation{}
+	groupOf := func(c carrier) *dcAllocation {
+		dcID := c.DistributionCenter.DistributionCenterID
+		if _, ok := groups[c.Carrier]; !ok {
+			groups[c.Carrier] = map[string]*dcAllocation{}
+		}
+		if _, ok := groups[c.Carrier][dcID]; !ok {
+			groups[c.Carrier][dcID] = &dcAllocation{
+				DistributionCenterID: dcID,
+				DeliveryCosts:        deliveryCosts[c.ID()],
+				HandlingCosts:        handlingCosts[c.ID()],
+				Items:                []assignmentOutput{},
+			}
+		}
+		return groups[c.Carrier][dcID]
+	}
+
+	for _, c := range carriers {
+		if round(deliveryCosts[c.ID()]+handlingCosts[c.ID()], precision) > 0 {
+			groupOf(c)
+		}
+	}
+
+	for _, a := range selected {
+		group := groupOf(carrier{DistributionCenter: a.DistributionCenter, Carrier: a.Carrier})
+
+		group.Volume += a.Item.UnitVolume * a.Quantity
+		group.Weight += a.Item.UnitWeight * a.Quantity
+		found := false
+		for index := range group.Items {
+			if group.Items[index].ItemID == a.Item.ItemID {
+				group.Items[index].Quantity = round(group.Items[index].Quantity+a.Quantity, precision)
+				found = true
+				break
+			}
+		}
+		if !found {
+			group.Items = append(group.Items, assignmentOutput{ItemID: a.Item.ItemID, Quantity: a.Quantity})
+		}
+	}
+
+	carrierIDs := make([]string, 0, len(groups))
+	for carrierID := range groups {
+		carrierIDs = append(carrierIDs, carrierID)
+	}
+	sort.Strings(carrierIDs)
+
+	plan := make([]carrierAllocation, 0, len(carrierIDs))
+	for _, carrierID := range carrierIDs {
+		dcIDs := make([]string, 0, len(groups[carrierID]))
+		for dcID := range groups[carrierID] {
+			dcIDs = append(dcIDs, dcID)
+		}
+		sort.Strings(dcIDs)
+
+		allocation := carrierAllocation{CarrierID: carrierID}
+		for _, dcID := range dcIDs {
+			group := groups[carrierID][dcID]
+			allocation.Volume += group.Volume
+			allocation.Weight += group.Weight
+			allocation.DeliveryCosts += group.DeliveryCosts
+			allocation.HandlingCosts += group.HandlingCosts
+			group.Volume = round(group.Volume, precision)
+			group.Weight = round(group.Weight, precision)
+			group.DeliveryCosts = round(group.DeliveryCosts, precision)
+			group.HandlingCosts = round(group.HandlingCosts, precision)
+			allocation.DistributionCenters = append(allocation.DistributionCenters, *group)
+		}
+		allocation.Volume = round(allocation.Volume, precision)
+		allocation.Weight = round(allocation.Weight, precision)
+		allocation.DeliveryCosts = round(allocation.DeliveryCosts, precision)
+		allocation.HandlingCosts = round(allocation.HandlingCosts, precision)
+		plan = append(plan, allocation)
+	}
+
+	return plan
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"math"
+	"slices"
+)
+
+// validate checks the referential integrity of the input. All problems found
+// are returned at once and name the offending IDs.
+func validate(i input) error {
+	var errs []error
+
+	itemIDs := make(map[string]bool, len(i.Items))
+	for _, it := range i.Items {
+		if itemIDs[it.ItemID] {
+			errs = append(errs, fmt.Errorf("item %q: duplicate item id", it.ItemID))
+		}
+		itemIDs[it.ItemID] = true
+		if it.Quantity <= 0 {
+			errs = append(errs, fmt.Errorf("item %q: quantity must be positive, got %v", it.ItemID, it.Quantity))
+		}
+		if it.Priority < 0 {
+			errs = append(errs, fmt.Errorf("item %q: priority must not be negative, got %v", it.ItemID, it.Priority))
+		}
+	}
+
+	dcIDs := make(map[string]bool, len(i.DistributionCenters))
+	for _, dc := range i.DistributionCenters {
+		if dcIDs[dc.DistributionCenterID] {
+			errs = append(errs, fmt.Errorf("distribution center %q: duplicate distribution center id", dc.DistributionCenterID))
+		}
+		dcIDs[dc.DistributionCenterID] = true
+		errs = append(errs, validateHandlingTiers(dc)...)
+	}
+
+	for _, it := range i.Items {
+		if it.PreferredDistributionCenterID != "" && !dcIDs[it.PreferredDistributionCenterID] {
+			errs = append(errs, fmt.Errorf(
+				"item %q: unknown preferred distribution center %q", it.ItemID, it.PreferredDistributionCenterID,
+			))
+		}
+	}
+
+	// Iterate the capacities in a stable order, so that the errors are
+	// reported deterministically.
+	for _, dcID := range sortedKeys(i.CarrierCapacities) {
+		if !dcIDs[dcID] {
+			errs = append(errs, fmt.Errorf("carrier capacities: unknown distribution center %q", dcID))
+			continue
+		}
+		for _, carrierID := range sortedKeys(i.CarrierCapacities[dcID]) {
+			errs = append(errs, validateDeliveryCosts(i, dcID, carrierID)...)
+			if _, ok := i.CarrierDimensionalWeightFactors[carrierID]; !ok {
+				errs = append(errs, fmt.Errorf("carrier %q: missing dimensional weight factor", carrierID))
+			}
+		}
+	}
+
+	for _, dcID := range sortedKeys(i.CarrierWeightCapacities) {
+		if !dcIDs[dcID] {
+			errs = append(errs, fmt.Errorf("carrier weight capacities: unknown distribution center %q", dcID))
+		}
+	}
+
+	for _, dcID := range sortedKeys(i.CarrierMaxCartons) {
+		if !dcIDs[dcID] {
+			errs = append(errs, fmt.Errorf("carrier max cartons: unknown distribution center %q", dcID))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// validateDeliveryCosts checks the delivery costs of a distribution center
+// carrier combination.
+func validateDeliveryCosts(i input, dcID, carrierID string) []error {
+	costs, ok := i.CarrierDeliveryCosts[dcID][carrierID]
+	if !ok {
+		return []error{
+			fmt.Errorf("distribution center %q, carrier %q: missing delivery costs", dcID, carrierID),
+		}
+	}
+
+	tiers, rates := costs["weight_tiers"], costs["weight_rates"]
+	if len(tiers) == 0 {
+		return []error{
+			fmt.Errorf("distribution center %q, carrier %q: missing weight_tiers", dcID, carrierID),
+		}
+	}
+	if len(tiers) != len(rates) {
+		return []error{
+			fmt.Errorf(
+				"distribution center %q, carrier %q: %d weight_tiers but %d weight_rates",
+				dcID, carrierID, len(tiers), len(rates),
+			),
+		}
+	}
+
+	return nil
+}
+
+// validateHandlingTiers checks that the handling tiers of a distribution center
+// have ascending limits and non-negative rates.
+func validateHandlingTiers(dc distributionCenter) []error {
+	var errs []error
+	previous := 0.0
+	for index, tier := range dc.HandlingTiers {
+		if tier.UpToCartons <= previous {
+			errs = append(errs, fmt.Errorf(
+				"distribution center %q: handling tier %d must have more than %v cartons, got %v",
+				dc.DistributionCenterID, index, previous, tier.UpToCartons,
+			))
+		}
+		if tier.Rate < 0 {
+			errs = append(errs, fmt.Errorf(
+				"distribution center %q: handling tier %d must have a non-negative rate, got %v",
+				dc.DistributionCenterID, index, tier.Rate,
+			))
+		}
+		previous = math.Max(previous, tier.UpToCartons)
+	}
+	return errs
+}
+
+// sortedKeys returns the keys of the map in ascending order. The model is
+// built in this order too, so that the solver finds the same of several
+// equally good solutions on every run.
+func sortedKeys[K cmp.Ordered, T any](m map[K]T) []K {
+	keys := make([]K, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+	return keys
+}
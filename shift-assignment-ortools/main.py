@@ -46,6 +46,12 @@ def main() -> None:
         default="SCIP",
         help="Solver provider. Default is SCIP.",
     )
+    parser.add_argument(
+        "-preference_weight",
+        default=0.0,
+        help="Weight of the preferences of the workers in the objective, 0 ignores them. Default is 0.",
+        type=float,
+    )
     args = parser.parse_args()
 
     # Read input data, solve the problem and write the solution.
@@ -55,11 +61,12 @@ def main() -> None:
     log(f"  - workers: {len(input_data.get('workers', []))}")
     log(f"  - rules: {len(input_data.get('rules', []))}")
     log(f"  - max duration: {args.duration} seconds")
-    solution = solve(input_data, args.duration, args.provider)
+    log(f"  - preference weight: {args.preference_weight}")
+    solution = solve(input_data, args.duration, args.provider, args.preference_weight)
     write_output(args.output, solution)
 
 
-def solve(input_data: dict[str, Any], duration: int, provider: str) -> dict[str, Any]:
+def solve(input_data: dict[str, Any], duration: int, provider: str, preference_weight: float) -> dict[str, Any]:
     """Solves the given problem and returns the solution."""
 
     # Creates the solver.
@@ -77,12 +84,20 @@ def solve(input_data: dict[str, Any], duration: int, provider: str) -> dict[str,
                 f'Assignment_{e["id"]}_{s["id"]}'
             )
 
+    # Create integer variables for the number of workers a shift is short of
+    x_unassigned = {}
+    for s in shifts:
+        x_unassigned[s["id"]] = solver.IntVar(0, s["count"], f"Unassigned_{s['id']}")
+
     # >>> Constraints
 
-    # Each shift must have the required number of workers
+    # Each shift must have the required number of workers, or is short of the
+    # ones that cannot be assigned
     for s in shifts:
         solver.Add(
-            solver.Sum([x_assign[(e["id"], s["id"])] for e in workers]) == s["count"],
+            solver.Sum([x_assign[(e["id"], s["id"])] for e in workers])
+            + x_unassigned[s["id"]]
+            == s["count"],
             f"Shift_{s['id']}",
         )
 
@@ -151,12 +166,20 @@ def solve(input_data: dict[str, Any], duration: int, provider: str) -> dict[str,
                 x_assign[(e["id"], s["id"])].SetBounds(0, 0)
 
     # >>> Objective
+    # Preferred shifts have a positive preference score and are rewarded,
+    # disliked ones have a negative score and are penalized
     objective = solver.Objective()
+    unassigned_penalty = 1
     for e in workers:
         for s in shifts:
             pref = e["preferences"].get(s["id"], 0)
-            if pref > 0:
-                objective.SetCoefficient(x_assign[(e["id"], s["id"])], pref)
+            if pref != 0:
+                objective.SetCoefficient(x_assign[(e["id"], s["id"])], preference_weight * pref)
+                unassigned_penalty += abs(preference_weight * pref)
+    # An unassigned worker costs more than all preferences together, so the
+    # shifts are covered as far as possible before preferences are considered
+    for s in shifts:
+        objective.SetCoefficient(x_unassigned[s["id"]], -unassigned_penalty)
     objective.SetMaximization()
 
     # Solves the problem.
@@ -164,7 +187,7 @@ def solve(input_data: dict[str, Any], duration: int, provider: str) -> dict[str,
 
     # Convert to solution format.
     schedule = {}
-    active_workers, total_workers = 0, 0
+    active_workers, total_workers, preference_satisfaction = 0, 0, 0
     if status == pywraplp.Solver.OPTIMAL or status == pywraplp.Solver.FEASIBLE:
         schedule = {
             "assigned_shifts": [
@@ -179,7 +202,38 @@ def solve(input_data: dict[str, Any], duration: int, provider: str) -> dict[str,
                 if x_assign[(e["id"], s["id"])].solution_value() > 0.5
             ],
         }
+        # Report the required and assigned workers per shift, and the shifts
+        # that are short of workers
+        assigned = {
+            s["id"]: sum(1 for e in workers if x_assign[(e["id"], s["id"])].solution_value() > 0.5)
+            for s in shifts
+        }
+        schedule["coverage"] = [
+            {
+                "shift_id": s["id"],
+                "required": s["count"],
+                "assigned": assigned[s["id"]],
+            }
+            for s in shifts
+        ]
+        schedule["unassigned"] = [
+            {
+                "start_time": s["start_time"],
+                "end_time": s["end_time"],
+                "shift_id": s["id"],
+                "count": s["count"] - assigned[s["id"]],
+            }
+            for s in shifts
+            if assigned[s["id"]] < s["count"]
+        ]
         active_workers = len({s["worker_id"] for s in schedule["assigned_shifts"]})
+        # The preference scores of the assignments, independent of their weight
+        preference_satisfaction = sum(
+            e["preferences"].get(s["id"], 0)
+            for e in workers
+            for s in shifts
+            if x_assign[(e["id"], s["id"])].solution_value() > 0.5
+        )
         total_workers = len(workers)
 
     # Creates the statistics.
@@ -192,6 +246,7 @@ def solve(input_data: dict[str, Any], duration: int, provider: str) -> dict[str,
                 "constraints": solver.NumConstraints(),
                 "active_workers": active_workers,
                 "total_workers": total_workers,
+                "preference_satisfaction": preference_satisfaction,
             },
             "duration": solver.WallTime() / 1000,
             "value": solver.Objective().Value()
@@ -208,6 +263,8 @@ def solve(input_data: dict[str, Any], duration: int, provider: str) -> dict[str,
     log(f"  - value: {statistics['result']['value']}")
     log(f"  - active workers: {statistics['result']['custom']['active_workers']}")
     log(f"  - total workers: {statistics['result']['custom']['total_workers']}")
+    log(f"  - preference satisfaction: {statistics['result']['custom']['preference_satisfaction']}")
+    log(f"  - unassigned shifts: {len(schedule.get('unassigned', []))}")
 
     return {
         "solutions": [schedule],
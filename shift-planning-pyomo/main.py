@@ -17,6 +17,13 @@ from pyomo.environ import (
     value,
 )
 
+# Supported solver providers and the names Pyomo knows them by.
+SUPPORTED_PROVIDERS = {
+    "cbc": "cbc",
+    "glpk": "glpk",
+    "highs": "appsi_highs",
+}
+
 # Status of the solver after optimizing.
 STATUS = {
     TerminationCondition.feasible: "suboptimal",
@@ -49,7 +56,7 @@ def main() -> None:
     parser.add_argument(
         "-provider",
         default="cbc",
-        help="Solver provider. Default is cbc.",
+        help=f"Solver provider, one of {', '.join(SUPPORTED_PROVIDERS)}. Default is cbc.",
     )
     args = parser.parse_args()
 
@@ -66,6 +73,16 @@ def main() -> None:
 def solve(input_data: dict[str, Any], duration: int, provider: str) -> dict[str, Any]:
     """Solves the given problem and returns the solution."""
 
+    # Make sure the provider is supported and installed.
+    if provider not in SUPPORTED_PROVIDERS:
+        raise ValueError(
+            f"Unsupported provider: {provider}. The supported providers are: {', '.join(SUPPORTED_PROVIDERS)}"
+        )
+    solver = SolverFactory(SUPPORTED_PROVIDERS[provider])
+    if not solver.available(exception_flag=False):
+        raise ValueError(f"Provider {provider} is not available. Make sure it is installed.")
+    version = solver.version()
+
     # Silence all Pyomo logging.
     logging.getLogger("pyomo.core").setLevel(logging.ERROR)
 
@@ -145,7 +162,6 @@ def solve(input_data: dict[str, Any], duration: int, provider: str) -> dict[str,
     )
 
     # Solve the model.
-    solver = SolverFactory(provider)
     results = solver.solve(model, tee=False, timelimit=duration)
 
     # Convert to solution format.
@@ -173,6 +189,7 @@ def solve(input_data: dict[str, Any], duration: int, provider: str) -> dict[str,
         "result": {
             "custom": {
                 "provider": provider,
+                "provider_version": ".".join(str(v) for v in version) if version else "unknown",
                 "status": STATUS.get(results.solver.termination_condition, "unknown"),
                 "has_solution": val is not None,
                 "constraints": model.nconstraints(),
@@ -296,17 +313,22 @@ def get_demand_coverage_periods(
             demands_per_qualification[qualification] = []
         demands_per_qualification[qualification].append(d)
 
-    # Determine all concrete shifts covering a demand
+    # Determine all concrete shifts covering a demand. A demand without a
+    # qualification is covered by any shift.
     shifts_per_qualification = {}
     for q in demands_per_qualification:
-        shifts_per_qualification[q] = [s for s in concrete_shifts if q == s["qualification"]]
+        shifts_per_qualification[q] = [s for s in concrete_shifts if q in ("", s["qualification"])]
 
     # Determine all unique time periods
     periods = []
     for q in demands_per_qualification:
+        # The periods without a qualification also count the demands with one,
+        # so that a qualified shift is not planned once for both.
+        relevant_demands = demands if q == "" else demands_per_qualification[q]
+
         # Determine all unique times for this qualification
         times = set()
-        for d in demands_per_qualification[q]:
+        for d in relevant_demands:
             times.add(d["start_time"])
             times.add(d["end_time"])
         for s in shifts_per_qualification[q]:
@@ -322,9 +344,9 @@ def get_demand_coverage_periods(
                 s for s in shifts_per_qualification[q] if s["start_time"] <= start and s["end_time"] >= end
             ]
             contributing_demands = [
-                d for d in demands_per_qualification[q] if d["start_time"] <= start and d["end_time"] >= end
+                d for d in relevant_demands if d["start_time"] <= start and d["end_time"] >= end
             ]
-            if not any(contributing_demands):
+            if not any(d["qualification"] == q for d in contributing_demands):
                 continue
             periods.append(
                 UniqueQualificationDemandPeriod(
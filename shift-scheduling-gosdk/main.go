@@ -3,9 +3,12 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
 	"math"
+	"slices"
+	"strings"
 	"time"
 
 	"github.com/nextmv-io/go-highs"
@@ -27,26 +30,65 @@ func solver(_ context.Context, input input, options options) (out schema.Output,
 	// We solve a shift coverage problem using Mixed Integer Programming.
 	// We solve this by generating all possible shifts
 	// and then selecting a subset of these
+	if options.Granularity <= 0 {
+		return schema.Output{}, fmt.Errorf("granularity must be positive, got %v", options.Granularity)
+	}
+	if options.Penalty.OvertimeMultiplier < 1 {
+		return schema.Output{}, fmt.Errorf(
+			"overtime multiplier must be at least 1, got %v", options.Penalty.OvertimeMultiplier,
+		)
+	}
+	if _, ok := weekdays[strings.ToLower(options.Limits.Week.StartDay)]; !ok {
+		return schema.Output{}, fmt.Errorf("unknown week start day %q", options.Limits.Week.StartDay)
+	}
+	if options.MaxWorkers < 0 {
+		return schema.Output{}, fmt.Errorf("max workers must not be negative, got %d", options.MaxWorkers)
+	}
+	if err := parseTemplates(input.ShiftTemplates); err != nil {
+		return schema.Output{}, err
+	}
+	input.RequiredWorkers = splitDemands(input.RequiredWorkers, options.Limits.Shift.MaxContinuous, options.Granularity)
 	potentialAssignments, potentialAssignmentsPerWorker := potentialAssignments(input, options)
+	potentialAssignments, potentialAssignmentsPerWorker, err := fixAssignments(
+		input, options, potentialAssignments, potentialAssignmentsPerWorker,
+	)
+	if err != nil {
+		return schema.Output{}, err
+	}
 	demands := demands(input, potentialAssignments)
 	m, x := newMIPModel(input, potentialAssignments, potentialAssignmentsPerWorker, demands, options)
 
 	solver := highs.NewSolver(m)
 
-	solution, err := solver.Solve(options.Solve)
+	solution, err := solver.Solve(options.Solve.mip())
 	if err != nil {
 		return schema.Output{}, err
 	}
+	// Without fixed assignments and hard minimum hours, leaving all shifts
+	// unassigned is always feasible, so these are to blame.
+	if solution.IsInfeasible() {
+		return schema.Output{}, errors.New(
+			"infeasible: the fixed assignments or the hard minimum weekly hours violate " +
+				"the recovery time or the daily or weekly limits",
+		)
+	}
+
+	// Optionally, format the solution into the assignments schema.
+	if options.Format.Assignments {
+		return formatAssignments(input, options, m, solution, x, potentialAssignments), nil
+	}
 
 	// Format the solution into the desired output format and add custom
 	// statistics.
-	output := mip.Format(options, format(solution, x, potentialAssignments), solution)
-	output.Statistics.Result.Custom = mip.DefaultCustomResultStatistics(m, solution)
+	output := mip.Format(options, format(input, options, solution, x, potentialAssignments), solution)
+	output.Statistics.Result.Custom = laborStatistics(options, m, solution, x, potentialAssignments)
 
 	return output, nil
 }
 
 func format(
+	input input,
+	opts options,
 	solverSolution mip.Solution,
 	x model.MultiMap[mip.Bool, assignment],
 	assignments []assignment,
@@ -55,25 +97,171 @@ func format(
 		return output{}
 	}
 	nextShiftSolution := output{}
-	usedWorkers := make(map[string]struct{})
+	summaries := make(map[string]*workerSummary)
 
 	for _, assignment := range assignments {
 		if solverSolution.Value(x.Get(assignment)) >= 0.9 {
 			nextShiftSolution.AssignedShifts = append(nextShiftSolution.AssignedShifts, outputAssignment{
-				Start:    assignment.Start,
-				End:      assignment.End,
-				WorkerID: assignment.Worker.ID,
+				Start:           assignment.Start,
+				End:             assignment.End,
+				WorkerID:        assignment.Worker.ID,
+				ShiftTemplateID: assignment.ShiftTemplateID,
 			})
-			if _, ok := usedWorkers[assignment.Worker.ID]; !ok {
-				usedWorkers[assignment.Worker.ID] = struct{}{}
+			summary, ok := summaries[assignment.Worker.ID]
+			if !ok {
+				summary = &workerSummary{WorkerID: assignment.Worker.ID}
+				summaries[assignment.Worker.ID] = summary
 			}
+			summary.AssignedHours += assignment.Duration.Hours()
+			summary.Shifts++
+		}
+	}
+	nextShiftSolution.NumberAssignedWorkers = len(summaries)
+
+	// Summarize all workers in the order of the input, including the ones
+	// without shifts.
+	shortfalls := minHoursShortfalls(input.Workers, opts, solverSolution, x, assignments)
+	nextShiftSolution.WorkerSummaries = make([]workerSummary, len(input.Workers))
+	for i, worker := range input.Workers {
+		nextShiftSolution.WorkerSummaries[i] = workerSummary{WorkerID: worker.ID}
+		if summary, ok := summaries[worker.ID]; ok {
+			nextShiftSolution.WorkerSummaries[i] = *summary
+		}
+		nextShiftSolution.WorkerSummaries[i].MinHoursShortfall = shortfalls[worker.ID]
+	}
+
+	covering := covering(solverSolution, x, assignments)
+	nextShiftSolution.DemandCoverage = make([]demandCoverage, len(input.RequiredWorkers))
+	for i, demand := range input.RequiredWorkers {
+		nextShiftSolution.DemandCoverage[i] = demandCoverage{
+			Start:    demand.Start,
+			End:      demand.End,
+			Required: demand.Count,
+			Covered:  covering[demand.requiredWorkerID],
 		}
 	}
-	nextShiftSolution.NumberAssignedWorkers = len(usedWorkers)
 
 	return nextShiftSolution
 }
 
+// covering counts the assigned workers covering each demand, keyed by the ID
+// of the demand.
+func covering(
+	solverSolution mip.Solution,
+	x model.MultiMap[mip.Bool, assignment],
+	assignments []assignment,
+) map[string]int {
+	covering := map[string]int{}
+	if !solverSolution.IsOptimal() && !solverSolution.IsSubOptimal() {
+		return covering
+	}
+	for _, assignment := range assignments {
+		if solverSolution.Value(x.Get(assignment)) < 0.9 {
+			continue
+		}
+		for _, demand := range assignment.DemandsCovered {
+			covering[demand.requiredWorkerID]++
+		}
+	}
+
+	return covering
+}
+
+// laborStatistics returns the default custom statistics together with the
+// requested gap, the wages and the overtime of the assigned shifts.
+func laborStatistics(
+	opts options,
+	m mip.Model,
+	solverSolution mip.Solution,
+	x model.MultiMap[mip.Bool, assignment],
+	assignments []assignment,
+) laborResultStatistics {
+	stats := laborResultStatistics{
+		CustomResultStatistics: mip.DefaultCustomResultStatistics(m, solverSolution),
+	}
+	if solverSolution.IsOptimal() {
+		gap := opts.Solve.MIP.Gap.Relative
+		stats.Gap = &gap
+	}
+	if !solverSolution.IsOptimal() && !solverSolution.IsSubOptimal() {
+		return stats
+	}
+
+	assigned := make([]assignment, 0)
+	for _, assignment := range assignments {
+		if solverSolution.Value(x.Get(assignment)) >= 0.9 {
+			assigned = append(assigned, assignment)
+			stats.LaborCost += assignment.laborCost()
+		}
+	}
+	stats.OvertimeHours, stats.OvertimeCost = overtime(assigned, opts)
+	stats.LaborCost += stats.OvertimeCost
+
+	return stats
+}
+
+// formatAssignments formats the solution into the assignments schema and adds
+// statistics about the coverage of the demands, the utilization of the workers
+// and the incurred penalties.
+func formatAssignments(
+	input input,
+	opts options,
+	m mip.Model,
+	solverSolution mip.Solution,
+	x model.MultiMap[mip.Bool, assignment],
+	assignments []assignment,
+) schema.Output {
+	stats := customResultStatistics{
+		laborResultStatistics: laborStatistics(opts, m, solverSolution, x, assignments),
+	}
+	solution := assignmentsOutput{
+		Assignments: make([]outputAssignment, 0),
+		Status:      stats.Status,
+	}
+	if solverSolution.HasValues() {
+		solution.Value = solverSolution.ObjectiveValue()
+	}
+	formatted := format(input, opts, solverSolution, x, assignments)
+	solution.Assignments = append(solution.Assignments, formatted.AssignedShifts...)
+
+	// Count the workers covering each demand.
+	covering := covering(solverSolution, x, assignments)
+
+	// Sum the assigned hours of all workers.
+	assignedHours := 0.0
+	for _, summary := range formatted.WorkerSummaries {
+		assignedHours += summary.AssignedHours
+	}
+
+	required, covered := 0, 0
+	for _, demand := range input.RequiredWorkers {
+		count := covering[demand.requiredWorkerID]
+		required += demand.Count
+		covered += min(count, demand.Count)
+		stats.OverSupplyPenalty += opts.Penalty.OverSupply * float64(max(count-demand.Count, 0))
+		stats.UnderSupplyPenalty += opts.Penalty.UnderSupply * float64(max(demand.Count-count, 0))
+	}
+	stats.Coverage = 1.0
+	if required > 0 {
+		stats.Coverage = float64(covered) / float64(required)
+	}
+
+	availableHours := 0.0
+	for _, worker := range input.Workers {
+		for _, availability := range worker.Availability {
+			availableHours += availability.End.Sub(availability.Start).Hours()
+		}
+	}
+	if availableHours > 0 {
+		stats.Utilization = assignedHours / availableHours
+	}
+
+	output := mip.Format(opts, solution, solverSolution)
+	output.Statistics.Result.Custom = stats
+
+	return output
+}
+
 func newMIPModel(
 	input input,
 	potentialAssignments []assignment,
@@ -89,6 +277,28 @@ func newMIPModel(
 			return m.NewBool()
 		}, potentialAssignments)
 
+	// Fixed assignments are always assigned.
+	for _, assignment := range potentialAssignments {
+		if assignment.Fixed {
+			fixed := m.NewConstraint(mip.Equal, 1.0)
+			fixed.NewTerm(1.0, x.Get(assignment))
+		}
+	}
+
+	// Every assigned shift incurs the wage of its worker, so that the payroll
+	// is minimized among the coverings of the demands.
+	for _, assignment := range potentialAssignments {
+		if cost := assignment.laborCost(); cost > 0 {
+			m.Objective().NewTerm(cost, x.Get(assignment))
+		}
+	}
+
+	// Overtime hours are paid at a premium.
+	addOvertime(m, x, potentialAssignmentsPerWorker, input.Workers, opts)
+
+	// Workers are owed their minimum weekly hours.
+	addMinHours(m, x, potentialAssignmentsPerWorker, input.Workers, opts)
+
 	underSupplySlack := model.NewMultiMap(
 		func(demand ...requiredWorker) mip.Float {
 			return m.NewFloat(0, float64(demand[0].Count))
@@ -119,32 +329,110 @@ func newMIPModel(
 		m.Objective().NewTerm(opts.Penalty.UnderSupply, underSupplySlack.Get(demand))
 	}
 
+	// Balance the assigned hours across the workers by minimizing the spread
+	// between the most and the least assigned hours.
+	if opts.FairnessWeight > 0 {
+		maxHours := m.NewFloat(0, math.MaxFloat64)
+		minHours := m.NewFloat(0, math.MaxFloat64)
+		for _, worker := range input.Workers {
+			hours := m.NewFloat(0, math.MaxFloat64)
+			hoursConstraint := m.NewConstraint(mip.Equal, 0.0)
+			hoursConstraint.NewTerm(1.0, hours)
+			for _, assignment := range potentialAssignmentsPerWorker[worker.ID] {
+				hoursConstraint.NewTerm(-assignment.Duration.Hours(), x.Get(assignment))
+			}
+			maxConstraint := m.NewConstraint(mip.GreaterThanOrEqual, 0.0)
+			maxConstraint.NewTerm(1.0, maxHours)
+			maxConstraint.NewTerm(-1.0, hours)
+			minConstraint := m.NewConstraint(mip.LessThanOrEqual, 0.0)
+			minConstraint.NewTerm(1.0, minHours)
+			minConstraint.NewTerm(-1.0, hours)
+		}
+		m.Objective().NewTerm(opts.FairnessWeight, maxHours)
+		m.Objective().NewTerm(-opts.FairnessWeight, minHours)
+	}
+
+	// Limit the number of workers that are assigned any shift. A worker is
+	// used if any of its shifts is assigned.
+	if opts.MaxWorkers > 0 {
+		maxWorkers := m.NewConstraint(mip.LessThanOrEqual, float64(opts.MaxWorkers))
+		for _, worker := range input.Workers {
+			used := m.NewBool()
+			maxWorkers.NewTerm(1.0, used)
+			for _, assignment := range potentialAssignmentsPerWorker[worker.ID] {
+				// assigned => used
+				link := m.NewConstraint(mip.LessThanOrEqual, 0.0)
+				link.NewTerm(1.0, x.Get(assignment))
+				link.NewTerm(-1.0, used)
+			}
+		}
+	}
+
+	// A worker cannot work overlapping shifts, whose hours would otherwise
+	// count twice toward the minimum weekly hours. Overlapping shifts share
+	// the later of their starts, so it suffices to allow at most one shift per
+	// worker running at every start.
+	for _, worker := range input.Workers {
+		assignments := potentialAssignmentsPerWorker[worker.ID]
+		starts := make([]time.Time, len(assignments))
+		for i, a := range assignments {
+			starts[i] = a.Start
+		}
+		slices.SortFunc(starts, time.Time.Compare)
+		starts = slices.CompactFunc(starts, time.Time.Equal)
+		for _, start := range starts {
+			running := make([]assignment, 0)
+			for _, a := range assignments {
+				if !a.Start.After(start) && a.End.After(start) {
+					running = append(running, a)
+				}
+			}
+			if len(running) < 2 {
+				continue
+			}
+			noOverlap := m.NewConstraint(mip.LessThanOrEqual, 1.0)
+			for _, a := range running {
+				noOverlap.NewTerm(1.0, x.Get(a))
+			}
+		}
+	}
+
+	// A worker can only work z hours per calendar week. A shift counts toward
+	// the week it starts in.
+	for _, worker := range input.Workers {
+		lessThanZhoursPerWeek := map[string]mip.Constraint{}
+		for _, a := range potentialAssignmentsPerWorker[worker.ID] {
+			week := weekKey(a, opts)
+			if _, ok := lessThanZhoursPerWeek[week]; !ok {
+				lessThanZhoursPerWeek[week] = m.NewConstraint(mip.LessThanOrEqual, opts.Limits.Week.MaxDuration.Hours())
+			}
+			lessThanZhoursPerWeek[week].NewTerm(a.Duration.Hours(), x.Get(a))
+		}
+	}
+
 	// Two shift of a worker have to be at least x hours apart
 	for _, worker := range input.Workers {
 		for i, a1 := range potentialAssignmentsPerWorker[worker.ID] {
 			// A worker can only work y hours per day
 			lessThanXhoursPerDay := m.NewConstraint(mip.LessThanOrEqual, opts.Limits.Day.MaxDuration.Hours())
 			lessThanXhoursPerDay.NewTerm(a1.Duration.Hours(), x.Get(a1))
-			atLeastYhoursApart := m.NewConstraint(mip.LessThanOrEqual, 1.0)
-			atLeastYhoursApart.NewTerm(1.0, x.Get(a1))
-			lessThanZhoursPerWeek := m.NewConstraint(mip.LessThanOrEqual, opts.Limits.Week.MaxDuration.Hours())
-			lessThanZhoursPerWeek.NewTerm(a1.Duration.Hours(), x.Get(a1))
 			for _, a2 := range potentialAssignmentsPerWorker[worker.ID][i+1:] {
+				// Touching and overlapping shifts are 0 hours apart.
 				durationApart := a1.DurationApart(a2)
-				if durationApart > 0 {
+				if durationApart < opts.Limits.Shift.RecoveryTime {
 					// if a1 and a2 do not at least have x hours between them, we
-					// forbid them to be assigned at the same time
-					if durationApart < opts.Limits.Shift.RecoveryTime {
-						atLeastYhoursApart.NewTerm(1.0, x.Get(a2))
-					}
-
-					if durationApart < 24*time.Hour {
-						lessThanXhoursPerDay.NewTerm(a2.Duration.Hours(), x.Get(a2))
-					}
+					// forbid them to be assigned at the same time. The
+					// constraint is added per pair, as two shifts that each
+					// conflict with a1 may well be compatible with each other.
+					forbidPair(m, x, a1, a2)
+				} else if durationApart == 0 && exceedsMaxContinuous(a1.span(a2), opts) {
+					// touching or overlapping shifts would make the worker
+					// work longer than allowed without a break
+					forbidPair(m, x, a1, a2)
+				}
 
-					if durationApart < 7*24*time.Hour {
-						lessThanZhoursPerWeek.NewTerm(a2.Duration.Hours(), x.Get(a2))
-					}
+				if durationApart < 24*time.Hour {
+					lessThanXhoursPerDay.NewTerm(a2.Duration.Hours(), x.Get(a2))
 				}
 			}
 		}
@@ -153,17 +441,28 @@ func newMIPModel(
 	return m, x
 }
 
+// forbidPair keeps the two assignments from being assigned both.
+func forbidPair(m mip.Model, x model.MultiMap[mip.Bool, assignment], a1, a2 assignment) {
+	conflict := m.NewConstraint(mip.LessThanOrEqual, 1.0)
+	conflict.NewTerm(1.0, x.Get(a1))
+	conflict.NewTerm(1.0, x.Get(a2))
+}
+
 func potentialAssignments(input input, opts options) ([]assignment, map[string][]assignment) {
+	if len(input.ShiftTemplates) > 0 {
+		return templateAssignments(input, opts)
+	}
+
 	potentialAssignments := make([]assignment, 0)
 	potentialAssignmentsPerWorker := map[string][]assignment{}
 	for _, worker := range input.Workers {
 		potentialAssignmentsPerWorker[worker.ID] = make([]assignment, 0)
 		for _, availability := range worker.Availability {
-			for start := availability.Start; start.Before(availability.End); start = start.Add(30 * time.Minute) {
-				for end := availability.End; start.Before(end); end = end.Add(-30 * time.Minute) {
+			for start := availability.Start; start.Before(availability.End); start = start.Add(opts.Granularity) {
+				for end := availability.End; start.Before(end); end = end.Add(-opts.Granularity) {
 					// make sure that end-start is not more than x hours
 					duration := end.Sub(start)
-					if duration > opts.Limits.Shift.MaxDuration {
+					if duration > opts.Limits.Shift.MaxDuration || exceedsMaxContinuous(duration, opts) {
 						continue
 					}
 					// make sure that end-start is not less than y hours - we are
@@ -171,6 +470,9 @@ func potentialAssignments(input input, opts options) ([]assignment, map[string][
 					if duration < opts.Limits.Shift.MinDuration {
 						break
 					}
+					if worker.isUnavailable(start, end) {
+						continue
+					}
 					assignment := assignment{
 						AssignmentID: fmt.Sprint(len(potentialAssignments)),
 						Start:        start,
@@ -187,6 +489,204 @@ func potentialAssignments(input input, opts options) ([]assignment, map[string][
 	return potentialAssignments, potentialAssignmentsPerWorker
 }
 
+// fixAssignments marks the potential assignments that match a fixed
+// assignment as fixed. Fixed assignments that were not generated, e.g. because
+// they lie outside of the availability of the worker, are added. An error is
+// returned if a fixed assignment refers to an unknown worker or violates the
+// limits of a shift, or if the fixed assignments use more than the maximum
+// number of workers.
+func fixAssignments(
+	input input,
+	opts options,
+	potentialAssignments []assignment,
+	potentialAssignmentsPerWorker map[string][]assignment,
+) ([]assignment, map[string][]assignment, error) {
+	workers := make(map[string]worker, len(input.Workers))
+	for _, worker := range input.Workers {
+		workers[worker.ID] = worker
+	}
+
+	for _, fixed := range input.FixedAssignments {
+		worker, ok := workers[fixed.WorkerID]
+		if !ok {
+			return nil, nil, fmt.Errorf("fixed assignment: unknown worker %q", fixed.WorkerID)
+		}
+		duration := fixed.End.Sub(fixed.Start)
+		if duration < opts.Limits.Shift.MinDuration || duration > opts.Limits.Shift.MaxDuration ||
+			exceedsMaxContinuous(duration, opts) {
+			return nil, nil, fmt.Errorf(
+				"infeasible: fixed assignment of worker %q from %v to %v violates the shift duration limits",
+				fixed.WorkerID, fixed.Start, fixed.End,
+			)
+		}
+
+		found := false
+		for i, assignment := range potentialAssignments {
+			if assignment.Worker.ID == fixed.WorkerID && assignment.Start.Equal(fixed.Start) &&
+				assignment.End.Equal(fixed.End) {
+				potentialAssignments[i].Fixed = true
+				found = true
+			}
+		}
+		if found {
+			continue
+		}
+
+		assignment := assignment{
+			AssignmentID:    fmt.Sprint(len(potentialAssignments)),
+			Start:           fixed.Start,
+			End:             fixed.End,
+			Worker:          worker,
+			Duration:        duration,
+			ShiftTemplateID: fixed.ShiftTemplateID,
+			Fixed:           true,
+		}
+		potentialAssignments = append(potentialAssignments, assignment)
+		potentialAssignmentsPerWorker[worker.ID] = append(potentialAssignmentsPerWorker[worker.ID], assignment)
+	}
+
+	fixedWorkers := map[string]struct{}{}
+	for _, fixed := range input.FixedAssignments {
+		fixedWorkers[fixed.WorkerID] = struct{}{}
+	}
+	if opts.MaxWorkers > 0 && len(fixedWorkers) > opts.MaxWorkers {
+		return nil, nil, fmt.Errorf(
+			"infeasible: the fixed assignments use %d workers, more than the maximum of %d",
+			len(fixedWorkers), opts.MaxWorkers,
+		)
+	}
+
+	return potentialAssignments, potentialAssignmentsPerWorker, nil
+}
+
+// exceedsMaxContinuous returns true if a shift of the given duration is longer
+// than a worker may work without a break.
+func exceedsMaxContinuous(duration time.Duration, opts options) bool {
+	return opts.Limits.Shift.MaxContinuous > 0 && duration > opts.Limits.Shift.MaxContinuous
+}
+
+// parseTemplates parses the durations of the shift templates. A template
+// needs either a start and an end or a positive duration.
+func parseTemplates(templates []shiftTemplate) error {
+	for i, template := range templates {
+		fixed := !template.Start.IsZero() || !template.End.IsZero()
+		if template.Duration == "" {
+			if !fixed || !template.Start.Before(template.End) {
+				return fmt.Errorf("shift template %q: needs a start before its end or a duration", template.ID)
+			}
+			continue
+		}
+		if fixed {
+			return fmt.Errorf("shift template %q: has both a start and end and a duration", template.ID)
+		}
+		length, err := time.ParseDuration(template.Duration)
+		if err != nil {
+			return fmt.Errorf("shift template %q: %w", template.ID, err)
+		}
+		if length <= 0 {
+			return fmt.Errorf("shift template %q: duration must be positive, got %v", template.ID, length)
+		}
+		templates[i].length = length
+	}
+
+	return nil
+}
+
+// templateAssignments creates an assignment for every shift template that fits
+// within an availability of a worker. Templates with only a duration are
+// instantiated at every step of the granularity within the availabilities.
+// Templates longer than the maximum continuous working time or overlapping an
+// unavailability are skipped.
+func templateAssignments(input input, opts options) ([]assignment, map[string][]assignment) {
+	potentialAssignments := make([]assignment, 0)
+	potentialAssignmentsPerWorker := map[string][]assignment{}
+	add := func(worker worker, template shiftTemplate, start, end time.Time) {
+		assignment := assignment{
+			AssignmentID:    fmt.Sprint(len(potentialAssignments)),
+			Start:           start,
+			End:             end,
+			Worker:          worker,
+			Duration:        end.Sub(start),
+			ShiftTemplateID: template.ID,
+		}
+		potentialAssignmentsPerWorker[worker.ID] = append(potentialAssignmentsPerWorker[worker.ID], assignment)
+		potentialAssignments = append(potentialAssignments, assignment)
+	}
+	for _, worker := range input.Workers {
+		potentialAssignmentsPerWorker[worker.ID] = make([]assignment, 0)
+		for _, template := range input.ShiftTemplates {
+			if template.length > 0 {
+				if exceedsMaxContinuous(template.length, opts) {
+					continue
+				}
+				for _, availability := range worker.Availability {
+					for start := availability.Start; ; start = start.Add(opts.Granularity) {
+						end := start.Add(template.length)
+						if end.After(availability.End) {
+							break
+						}
+						if !worker.isUnavailable(start, end) {
+							add(worker, template, start, end)
+						}
+					}
+				}
+				continue
+			}
+
+			if exceedsMaxContinuous(template.End.Sub(template.Start), opts) ||
+				worker.isUnavailable(template.Start, template.End) {
+				continue
+			}
+			for _, availability := range worker.Availability {
+				if template.Start.Before(availability.Start) || template.End.After(availability.End) {
+					continue
+				}
+				add(worker, template, template.Start, template.End)
+				break
+			}
+		}
+	}
+	return potentialAssignments, potentialAssignmentsPerWorker
+}
+
+// splitDemands splits every demand that is longer than the maximum continuous
+// working time into consecutive demands of about equal length, rounded up to
+// the granularity of the shifts. Each of them requires the same number of
+// workers and can be covered by a different shift. A maximum of 0 keeps the
+// demands as they are.
+func splitDemands(demands []requiredWorker, maxContinuous, granularity time.Duration) []requiredWorker {
+	if maxContinuous <= 0 {
+		return demands
+	}
+
+	split := make([]requiredWorker, 0, len(demands))
+	for _, demand := range demands {
+		duration := demand.End.Sub(demand.Start)
+		pieces := int(math.Ceil(float64(duration) / float64(maxContinuous)))
+		if pieces <= 1 {
+			split = append(split, demand)
+			continue
+		}
+		length := (duration / time.Duration(pieces)).Round(granularity)
+		if length*time.Duration(pieces) < duration {
+			length += granularity
+		}
+		// Rounding must not result in demands that are too long, any
+		// remainder is split off as another demand.
+		length = min(length, maxContinuous)
+		for start := demand.Start; start.Before(demand.End); start = start.Add(length) {
+			piece := demand
+			piece.Start = start
+			piece.End = start.Add(length)
+			if piece.End.After(demand.End) {
+				piece.End = demand.End
+			}
+			split = append(split, piece)
+		}
+	}
+	return split
+}
+
 func demands(input input, potentialAssignments []assignment) map[string][]assignment {
 	// initialize demand ids
 	for i, demand := range input.RequiredWorkers {
@@ -198,6 +698,10 @@ func demands(input input, potentialAssignments []assignment) map[string][]assign
 	for _, demand := range input.RequiredWorkers {
 		demandCovering[demand.requiredWorkerID] = []assignment{}
 		for i, potentialAssignment := range potentialAssignments {
+			if !potentialAssignment.Worker.hasSkill(demand.Skill) ||
+				potentialAssignment.Worker.LocationID != demand.LocationID {
+				continue
+			}
 			if (potentialAssignment.Start.Before(demand.Start) || potentialAssignment.Start.Equal(demand.Start)) &&
 				(potentialAssignment.End.After(demand.End) || potentialAssignment.End.Equal(demand.End)) {
 				potentialAssignments[i].DemandsCovered = append(potentialAssignments[i].DemandsCovered, demand)
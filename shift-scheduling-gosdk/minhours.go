@@ -0,0 +1,74 @@
+package main
+
+import (
+	"math"
+
+	"github.com/nextmv-io/go-mip"
+	"github.com/nextmv-io/go-mip/model"
+)
+
+// addMinHours makes sure that every worker reaches its minimum weekly hours in
+// every calendar week it has potential shifts in. By default, the hours short
+// of the minimum are penalized in the objective. With hard minimum hours, the
+// minimum has to be reached.
+func addMinHours(
+	m mip.Model,
+	x model.MultiMap[mip.Bool, assignment],
+	potentialAssignmentsPerWorker map[string][]assignment,
+	workers []worker,
+	opts options,
+) {
+	for _, worker := range workers {
+		if worker.MinWeeklyHours <= 0 {
+			continue
+		}
+
+		// week -> constraint linking the weekly hours to the minimum.
+		weeks := map[string]mip.Constraint{}
+		for _, a := range potentialAssignmentsPerWorker[worker.ID] {
+			week := weekKey(a, opts)
+			if _, ok := weeks[week]; !ok {
+				// hours + shortfall >= minimum
+				weeks[week] = m.NewConstraint(mip.GreaterThanOrEqual, worker.MinWeeklyHours)
+				if !opts.Limits.Week.HardMinHours {
+					shortfall := m.NewFloat(0, math.MaxFloat64)
+					weeks[week].NewTerm(1.0, shortfall)
+					m.Objective().NewTerm(opts.Penalty.MinHours, shortfall)
+				}
+			}
+			weeks[week].NewTerm(a.Duration.Hours(), x.Get(a))
+		}
+	}
+}
+
+// minHoursShortfalls returns per worker the sum of the hours it falls short of
+// its minimum weekly hours in the weeks it has potential shifts in.
+func minHoursShortfalls(
+	workers []worker,
+	opts options,
+	solverSolution mip.Solution,
+	x model.MultiMap[mip.Bool, assignment],
+	assignments []assignment,
+) map[string]float64 {
+	// worker -> week -> assigned hours.
+	hours := map[string]map[string]float64{}
+	for _, a := range assignments {
+		if _, ok := hours[a.Worker.ID]; !ok {
+			hours[a.Worker.ID] = map[string]float64{}
+		}
+		week := weekKey(a, opts)
+		hours[a.Worker.ID][week] += 0
+		if solverSolution.Value(x.Get(a)) >= 0.9 {
+			hours[a.Worker.ID][week] += a.Duration.Hours()
+		}
+	}
+
+	shortfalls := map[string]float64{}
+	for _, worker := range workers {
+		for _, assigned := range hours[worker.ID] {
+			shortfalls[worker.ID] += math.Max(worker.MinWeeklyHours-assigned, 0)
+		}
+	}
+
+	return shortfalls
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"math"
+	"strings"
+	"time"
+
+	"github.com/nextmv-io/go-mip"
+	"github.com/nextmv-io/go-mip/model"
+)
+
+// dayKey returns the calendar day a shift starting at the given assignment
+// counts toward.
+func dayKey(a assignment) string {
+	return a.Start.Format(time.DateOnly)
+}
+
+// weekdays maps the names of the days to the weekdays a week can start on.
+var weekdays = map[string]time.Weekday{
+	"sunday":    time.Sunday,
+	"monday":    time.Monday,
+	"tuesday":   time.Tuesday,
+	"wednesday": time.Wednesday,
+	"thursday":  time.Thursday,
+	"friday":    time.Friday,
+	"saturday":  time.Saturday,
+}
+
+// weekKey returns the calendar week a shift starting at the given assignment
+// counts toward, identified by the date of its first day. Weeks start on the
+// configured day, Monday by default.
+func weekKey(a assignment, opts options) string {
+	startDay := weekdays[strings.ToLower(opts.Limits.Week.StartDay)]
+	offset := (int(a.Start.Weekday()) - int(startDay) + 7) % 7
+	year, month, day := a.Start.Date()
+	return time.Date(year, month, day-offset, 0, 0, 0, 0, a.Start.Location()).Format(time.DateOnly)
+}
+
+// hasOvertime returns true if a daily or weekly overtime threshold is set.
+func hasOvertime(opts options) bool {
+	return opts.Limits.Day.OvertimeThreshold > 0 || opts.Limits.Week.OvertimeThreshold > 0
+}
+
+// addOvertime adds the premium for overtime hours to the objective. The hours
+// of a worker beyond the daily threshold per calendar day and beyond the
+// weekly threshold per calendar week are overtime. Hours are not paid twice: the
+// overtime of a week is the larger of its daily overtime hours and its weekly
+// overtime hours. The premium is the wage of the worker times the overtime
+// multiplier minus 1, as the regular wage is already part of the labor cost.
+func addOvertime(
+	m mip.Model,
+	x model.MultiMap[mip.Bool, assignment],
+	potentialAssignmentsPerWorker map[string][]assignment,
+	workers []worker,
+	opts options,
+) {
+	if !hasOvertime(opts) {
+		return
+	}
+
+	for _, worker := range workers {
+		premium := worker.HourlyWage * (opts.Penalty.OvertimeMultiplier - 1)
+		if premium <= 0 {
+			continue
+		}
+
+		// week -> overtime hours of the week.
+		weeks := map[string]mip.Float{}
+		// week -> constraint linking the daily overtime to the weekly one.
+		weeklyDaily := map[string]mip.Constraint{}
+		// week -> constraint linking the weekly hours to the weekly overtime.
+		weeklyHours := map[string]mip.Constraint{}
+		// day -> constraint linking the daily hours to the daily overtime.
+		dailyHours := map[string]mip.Constraint{}
+		for _, a := range potentialAssignmentsPerWorker[worker.ID] {
+			week := weekKey(a, opts)
+			if _, ok := weeks[week]; !ok {
+				weeks[week] = m.NewFloat(0, math.MaxFloat64)
+				m.Objective().NewTerm(premium, weeks[week])
+				// overtime >= sum of the daily overtime
+				weeklyDaily[week] = m.NewConstraint(mip.GreaterThanOrEqual, 0.0)
+				weeklyDaily[week].NewTerm(1.0, weeks[week])
+				if opts.Limits.Week.OvertimeThreshold > 0 {
+					// overtime >= hours - weekly threshold
+					weeklyHours[week] = m.NewConstraint(
+						mip.GreaterThanOrEqual,
+						-opts.Limits.Week.OvertimeThreshold.Hours(),
+					)
+					weeklyHours[week].NewTerm(1.0, weeks[week])
+				}
+			}
+			if constraint, ok := weeklyHours[week]; ok {
+				constraint.NewTerm(-a.Duration.Hours(), x.Get(a))
+			}
+
+			if opts.Limits.Day.OvertimeThreshold <= 0 {
+				continue
+			}
+			day := dayKey(a)
+			if _, ok := dailyHours[day]; !ok {
+				overtime := m.NewFloat(0, math.MaxFloat64)
+				weeklyDaily[week].NewTerm(-1.0, overtime)
+				// overtime >= hours - daily threshold
+				dailyHours[day] = m.NewConstraint(
+					mip.GreaterThanOrEqual,
+					-opts.Limits.Day.OvertimeThreshold.Hours(),
+				)
+				dailyHours[day].NewTerm(1.0, overtime)
+			}
+			dailyHours[day].NewTerm(-a.Duration.Hours(), x.Get(a))
+		}
+	}
+}
+
+// overtime returns the overtime hours of the assigned shifts and the premium
+// paid for them, following the same rules as the model.
+func overtime(assigned []assignment, opts options) (hours, cost float64) {
+	if !hasOvertime(opts) {
+		return 0, 0
+	}
+
+	type key struct {
+		workerID string
+		period   string
+	}
+	workers := map[string]worker{}
+	dayHours := map[key]float64{}
+	weekHours := map[key]float64{}
+	dayWeek := map[key]string{}
+	for _, a := range assigned {
+		workers[a.Worker.ID] = a.Worker
+		dayHours[key{a.Worker.ID, dayKey(a)}] += a.Duration.Hours()
+		weekHours[key{a.Worker.ID, weekKey(a, opts)}] += a.Duration.Hours()
+		dayWeek[key{a.Worker.ID, dayKey(a)}] = weekKey(a, opts)
+	}
+
+	dailyOvertime := map[key]float64{}
+	if opts.Limits.Day.OvertimeThreshold > 0 {
+		for day, h := range dayHours {
+			week := key{day.workerID, dayWeek[day]}
+			dailyOvertime[week] += math.Max(h-opts.Limits.Day.OvertimeThreshold.Hours(), 0)
+		}
+	}
+
+	for week, h := range weekHours {
+		weekly := 0.0
+		if opts.Limits.Week.OvertimeThreshold > 0 {
+			weekly = math.Max(h-opts.Limits.Week.OvertimeThreshold.Hours(), 0)
+		}
+		overtimeHours := math.Max(weekly, dailyOvertime[week])
+		hours += overtimeHours
+		cost += overtimeHours * workers[week.workerID].HourlyWage * (opts.Penalty.OvertimeMultiplier - 1)
+	}
+
+	return hours, cost
+}
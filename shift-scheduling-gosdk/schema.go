@@ -1,6 +1,7 @@
 package main
 
 import (
+	"slices"
 	"time"
 
 	"github.com/nextmv-io/go-mip"
@@ -10,13 +11,114 @@ import (
 type output struct {
 	AssignedShifts        []outputAssignment `json:"assigned_shifts"`
 	NumberAssignedWorkers int                `json:"number_assigned_workers"`
+	WorkerSummaries       []workerSummary    `json:"worker_summaries"`
+	DemandCoverage        []demandCoverage   `json:"demand_coverage"`
+}
+
+// workerSummary holds the assigned hours and shifts of a worker.
+type workerSummary struct {
+	WorkerID      string  `json:"worker_id"`
+	AssignedHours float64 `json:"assigned_hours"`
+	Shifts        int     `json:"shifts"`
+	// MinHoursShortfall is the sum of the hours the worker falls short of its
+	// minimum weekly hours.
+	MinHoursShortfall float64 `json:"min_hours_shortfall"`
+}
+
+// demandCoverage holds the number of workers covering a demand window
+// compared to the number of required workers.
+type demandCoverage struct {
+	Start    time.Time `json:"start,omitempty"`
+	End      time.Time `json:"end,omitempty"`
+	Required int       `json:"required"`
+	Covered  int       `json:"covered"`
+}
+
+// assignmentsOutput holds the output data of the solution in the assignments
+// schema.
+type assignmentsOutput struct {
+	Assignments []outputAssignment `json:"assignments"`
+	Status      string             `json:"status"`
+	Value       float64            `json:"value"`
+}
+
+// laborResultStatistics extends the default custom statistics by the requested
+// gap and the labor cost of the assigned shifts.
+type laborResultStatistics struct {
+	mip.CustomResultStatistics
+	// Gap is the requested relative gap, not a measured one: go-mip does not
+	// expose the gap that the solver achieved. It is only given if the
+	// solution is optimal, i.e. the solver stopped at the requested gap.
+	Gap *float64 `json:"gap,omitempty"`
+	// LaborCost is the sum of the wages paid for the assigned shifts,
+	// including the overtime premium.
+	LaborCost float64 `json:"labor_cost"`
+	// OvertimeHours are the hours beyond the daily or weekly overtime
+	// threshold, OvertimeCost is the premium paid for them.
+	OvertimeHours float64 `json:"overtime_hours"`
+	OvertimeCost  float64 `json:"overtime_cost"`
+}
+
+// customResultStatistics holds the custom statistics of the assignments
+// schema.
+type customResultStatistics struct {
+	laborResultStatistics
+	// Coverage is the share of required workers that are covered.
+	Coverage float64 `json:"coverage"`
+	// Utilization is the share of the available time of the workers that is
+	// assigned.
+	Utilization        float64 `json:"utilization"`
+	OverSupplyPenalty  float64 `json:"over_supply_penalty"`
+	UnderSupplyPenalty float64 `json:"under_supply_penalty"`
 }
 
 // options holds custom configuration data.
 type options struct {
-	Penalty penalty          `json:"penalty" usage:"set penalties for over and under supply of workers"`
-	Limits  limits           `json:"limits" usage:"holds fields to configure the models limits"`
-	Solve   mip.SolveOptions `json:"solve" usage:"holds fields to configure the solver"`
+	Penalty penalty       `json:"penalty" usage:"set penalties for over and under supply of workers"`
+	Limits  limits        `json:"limits" usage:"holds fields to configure the models limits"`
+	Format  formatOptions `json:"format" usage:"holds fields to configure the output format"`
+	Solve   solveOptions  `json:"solve" usage:"holds fields to configure the solver"`
+	// Granularity is the step between the start and end times of the
+	// generated shifts.
+	Granularity time.Duration `json:"granularity" default:"30m" usage:"step of shift times (smaller = larger model)"`
+	// FairnessWeight weighs the spread between the most and the least
+	// assigned hours of the workers in the objective.
+	FairnessWeight float64 `json:"fairness_weight" usage:"weight of the spread of the assigned hours per worker"`
+	// MaxWorkers caps the number of distinct workers that are assigned any
+	// shift. Demands that cannot be covered as a result are under-supplied.
+	MaxWorkers int `json:"max_workers" usage:"maximum number of assigned workers (0 = no limit)"`
+}
+
+// solveOptions configures the solver. It mirrors mip.SolveOptions but stops at
+// a relative gap of 1% by default, as proving optimality is hopeless for large
+// workforces.
+type solveOptions struct {
+	Duration  time.Duration `json:"duration" default:"30s" usage:"maximum duration of the solver"`
+	Verbosity mip.Verbosity `json:"verbosity" default:"off" usage:"{off, low, medium, high} verbosity of the solver"`
+	MIP       struct {
+		Gap struct {
+			Absolute float64 `json:"absolute" default:"0.000001" usage:"absolute gap at which to stop"`
+			Relative float64 `json:"relative" default:"0.01" usage:"relative gap at which to stop (0.01 = 1%)"`
+		} `json:"gap"`
+	} `json:"mip"`
+	Control mip.ControlOptions `json:"control" usage:"solver-specific control options"`
+}
+
+// mip converts the options into the solve options of the solver.
+func (o solveOptions) mip() mip.SolveOptions {
+	solveOptions := mip.SolveOptions{
+		Duration:  o.Duration,
+		Verbosity: o.Verbosity,
+		Control:   o.Control,
+	}
+	solveOptions.MIP.Gap.Absolute = o.MIP.Gap.Absolute
+	solveOptions.MIP.Gap.Relative = o.MIP.Gap.Relative
+
+	return solveOptions
+}
+
+type formatOptions struct {
+	Assignments bool `json:"assignments" usage:"output the shifts in the assignments schema"`
 }
 
 type limits struct {
@@ -24,30 +126,90 @@ type limits struct {
 		MinDuration  time.Duration `json:"min_duration" default:"2h" usage:"minimum working time per shift"`
 		MaxDuration  time.Duration `json:"max_duration" default:"8h" usage:"maximum working time per shift"`
 		RecoveryTime time.Duration `json:"recovery_time" default:"8h" usage:"minimum time between shifts"`
+		// MaxContinuous is the longest a worker may work without a break. Longer
+		// shifts are not generated and longer demands are split, so that they
+		// are covered by several shifts.
+		MaxContinuous time.Duration `json:"max_continuous" usage:"maximum continuous working time (0 = no limit)"`
 	} `json:"shift"`
 	Week struct {
-		MaxDuration time.Duration `json:"max_duration" default:"40h" usage:"maximum working time per week"`
+		MaxDuration       time.Duration `json:"max_duration" default:"40h" usage:"maximum working time per week"`
+		OvertimeThreshold time.Duration `json:"overtime_threshold" usage:"working time per week after which overtime is paid"`
+		// HardMinHours turns the minimum weekly hours of the workers into a
+		// hard constraint instead of penalizing the shortfall.
+		HardMinHours bool `json:"hard_min_hours" usage:"enforce the minimum weekly hours of the workers"`
+		// StartDay is the first day of the calendar weeks the weekly limits,
+		// overtime and minimum hours apply to.
+		StartDay string `json:"start_day" default:"monday" usage:"first day of the week, e.g. sunday"`
 	} `json:"week"`
 	Day struct {
-		MaxDuration time.Duration `json:"max_duration" default:"10h" usage:"maximum working time per day"`
+		MaxDuration       time.Duration `json:"max_duration" default:"10h" usage:"maximum working time per day"`
+		OvertimeThreshold time.Duration `json:"overtime_threshold" usage:"working time per day after which overtime is paid"`
 	} `json:"day"`
 }
 
 type penalty struct {
 	OverSupply  float64 `json:"over_supply" default:"1000" usage:"penalty for over-supplying a demand"`
 	UnderSupply float64 `json:"under_supply" default:"500" usage:"penalty for under-supplying a demand"`
+	// OvertimeMultiplier is the factor of the hourly wage paid for overtime.
+	OvertimeMultiplier float64 `json:"overtime_multiplier" default:"1.5" usage:"wage multiplier for overtime hours"`
+	// MinHours is the penalty per hour a worker falls short of its minimum
+	// weekly hours.
+	MinHours float64 `json:"min_hours" default:"100" usage:"penalty per hour below the minimum weekly hours of a worker"`
 }
 
 // input represents a struct definition that can read input.json.
 type input struct {
 	Workers         []worker         `json:"workers"`
 	RequiredWorkers []requiredWorker `json:"required_workers"`
+	ShiftTemplates  []shiftTemplate  `json:"shift_templates,omitempty"`
+	// FixedAssignments are shifts committed in advance. They are always
+	// assigned and the remaining shifts are scheduled around them.
+	FixedAssignments []outputAssignment `json:"fixed_assignments,omitempty"`
+}
+
+// shiftTemplate is a named shift of a fixed catalog. If a catalog is given,
+// shifts are only generated from it instead of enumerating all start and end
+// times. A template either has a fixed start and end or only a duration, e.g.
+// "8h", in which case it may start at every step of the granularity.
+type shiftTemplate struct {
+	ID       string    `json:"id"`
+	Start    time.Time `json:"start,omitempty"`
+	End      time.Time `json:"end,omitempty"`
+	Duration string    `json:"duration,omitempty"`
+
+	// length is the parsed duration of the template.
+	length time.Duration `json:"-"`
 }
 
-// worker holds worker specific data.
+// worker holds worker specific data. Unavailabilities, e.g. approved time
+// off, take precedence over the availabilities. A worker only works at its
+// location and is owed its minimum hours in every week it is available.
 type worker struct {
-	Availability []availability `json:"availability"`
-	ID           string         `json:"id"`
+	Availability   []availability `json:"availability"`
+	Unavailability []availability `json:"unavailability,omitempty"`
+	ID             string         `json:"id"`
+	Skills         []string       `json:"skills,omitempty"`
+	HourlyWage     float64        `json:"hourly_wage,omitempty"`
+	LocationID     string         `json:"location_id,omitempty"`
+	MinWeeklyHours float64        `json:"min_weekly_hours,omitempty"`
+}
+
+// isUnavailable returns true if a shift from start to end overlaps an
+// unavailability of the worker. Shifts that only touch an unavailability are
+// allowed.
+func (w worker) isUnavailable(start, end time.Time) bool {
+	for _, unavailability := range w.Unavailability {
+		if start.Before(unavailability.End) && end.After(unavailability.Start) {
+			return true
+		}
+	}
+	return false
+}
+
+// hasSkill returns true if the worker has the given skill. Every worker has
+// the empty skill.
+func (w worker) hasSkill(skill string) bool {
+	return skill == "" || slices.Contains(w.Skills, skill)
 }
 
 // availability holds available times for a worker.
@@ -57,11 +219,15 @@ type availability struct {
 }
 
 // requiredWorker holds data about times and number of required workers per time window.
+// If a skill is given, only workers with that skill can cover the demand. Only
+// workers of the same location can cover the demand.
 type requiredWorker struct {
 	requiredWorkerID string    `json:"-"`
 	Start            time.Time `json:"start"`
 	End              time.Time `json:"end"`
 	Count            int       `json:"count"`
+	Skill            string    `json:"skill,omitempty"`
+	LocationID       string    `json:"location_id,omitempty"`
 }
 
 // ID returned the RequiredWorker ID.
@@ -71,9 +237,10 @@ func (r requiredWorker) ID() string {
 
 // outputAssignment holds an assignment for a worker.
 type outputAssignment struct {
-	Start    time.Time `json:"start"`
-	End      time.Time `json:"end"`
-	WorkerID string    `json:"worker_id"`
+	Start           time.Time `json:"start"`
+	End             time.Time `json:"end"`
+	WorkerID        string    `json:"worker_id"`
+	ShiftTemplateID string    `json:"shift_template_id,omitempty"`
 }
 
 // assignment represents a shift assignment.
@@ -84,6 +251,11 @@ type assignment struct {
 	Worker         worker           `json:"worker"`
 	Duration       time.Duration    `json:"duration"`
 	AssignmentID   string           `json:"assignment_id"`
+	// ShiftTemplateID is the ID of the shift template the assignment was
+	// generated from, if any.
+	ShiftTemplateID string `json:"shift_template_id,omitempty"`
+	// Fixed is true if the assignment was committed in advance.
+	Fixed bool `json:"fixed,omitempty"`
 }
 
 // DurationApart calculates the time to assignments are apart from each other.
@@ -97,6 +269,24 @@ func (a assignment) DurationApart(other assignment) time.Duration {
 	return 0
 }
 
+// span returns the time from the earlier start to the later end of the
+// assignments.
+func (a assignment) span(other assignment) time.Duration {
+	start, end := a.Start, a.End
+	if other.Start.Before(start) {
+		start = other.Start
+	}
+	if other.End.After(end) {
+		end = other.End
+	}
+	return end.Sub(start)
+}
+
+// laborCost returns the wage paid to the worker for the assignment.
+func (a assignment) laborCost() float64 {
+	return a.Worker.HourlyWage * a.Duration.Hours()
+}
+
 // ID returns the assignment id.
 func (a assignment) ID() string {
 	return a.AssignmentID
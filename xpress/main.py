@@ -5,20 +5,40 @@ Template for working with FICO Xpress.
 import argparse
 import json
 import sys
+from collections.abc import Callable
 from typing import Any
 
+from ortools.linear_solver import pywraplp
+
 try:
     import xpress as xp
-except ImportError as exc:
-    raise ImportError("is xpress available for your OS and ARCH and installed?") from exc
+except ImportError:
+    # Without Xpress, e.g. on an OS and ARCH it is not available for, the app
+    # can still solve the problem with the open-source fallback.
+    xp = None
+
 
+# Status of the Xpress solver after optimizing.
+STATUS = (
+    {
+        xp.SolStatus.FEASIBLE: "suboptimal",
+        xp.SolStatus.INFEASIBLE: "infeasible",
+        xp.SolStatus.OPTIMAL: "optimal",
+        xp.SolStatus.UNBOUNDED: "unbounded",
+    }
+    if xp is not None
+    else {}
+)
 
-# Status of the solver after optimizing.
-STATUS = {
-    xp.SolStatus.FEASIBLE: "suboptimal",
-    xp.SolStatus.INFEASIBLE: "infeasible",
-    xp.SolStatus.OPTIMAL: "optimal",
-    xp.SolStatus.UNBOUNDED: "unbounded",
+# Status of the open-source fallback solver after optimizing.
+SCIP_STATUS = {
+    pywraplp.Solver.FEASIBLE: "suboptimal",
+    pywraplp.Solver.INFEASIBLE: "infeasible",
+    pywraplp.Solver.OPTIMAL: "optimal",
+    pywraplp.Solver.UNBOUNDED: "unbounded",
+    pywraplp.Solver.ABNORMAL: "abnormal",
+    pywraplp.Solver.NOT_SOLVED: "not_solved",
+    pywraplp.Solver.MODEL_INVALID: "model_invalid",
 }
 
 
@@ -42,51 +62,94 @@ def main() -> None:
         help="Max runtime duration (in seconds). Default is 30.",
         type=int,
     )
+    parser.add_argument(
+        "-duals",
+        action="store_true",
+        help="Report the duals of the LP relaxation. Default is false.",
+    )
+    parser.add_argument(
+        "-solver",
+        choices=["xpress", "auto", "scip"],
+        default="xpress",
+        help="Solver to use. With auto, Xpress is used if a full license is present, "
+        "otherwise the open-source SCIP. Default is xpress.",
+    )
     args = parser.parse_args()
 
+    # Without a full license, Xpress runs with its community license, which
+    # limits the size of the problems it solves.
+    solver = args.solver
+    if solver == "auto":
+        solver = "xpress" if has_full_license() else "scip"
+
     # Read input data, solve the problem and write the solution.
     input_data = read_input(args.input)
     log("Solving knapsack problem:")
     log(f"  - items: {len(input_data.get('items', []))}")
-    log(f"  - capacity: {input_data.get('weight_capacity', 0)}")
+    log(f"  - capacity: {input_data.get('capacities', input_data.get('weight_capacity', 0))}")
     log(f"  - max duration: {args.duration} seconds")
-    solution = solve(input_data, args.duration)
+    log(f"  - solver: {solver}")
+    if solver == "xpress":
+        solution = solve(input_data, args.duration, args.duals)
+    else:
+        solution = solve_scip(input_data, args.duration, args.duals)
     write_output(args.output, solution)
 
 
-def solve(input_data: dict[str, Any], duration: int) -> dict[str, Any]:
-    """Solves the given problem and returns the solution."""
+def has_full_license() -> bool:
+    """
+    Returns whether Xpress is installed with a full license. Without a license
+    file, Xpress uses its community license and reports it as the licensing
+    message.
+    """
+
+    if xp is None:
+        return False
+    try:
+        xp.init()
+    except (xp.InterfaceError, xp.SolverError):
+        return False
+
+    return "community" not in xp.getlicerrmsg().lower()
+
+
+def solve(input_data: dict[str, Any], duration: int, duals: bool) -> dict[str, Any]:
+    """Solves the given problem with Xpress and returns the solution."""
+
+    if xp is None:
+        raise ImportError("is xpress available for your OS and ARCH and installed?")
 
     # Creates the problem.
     xp.controls.outputlog = 0  # Turns off verbosity.
     problem = xp.problem()
     problem.setControl("timelimit", duration)
 
-    # Initializes the linear sums.
-    weights = 0.0
-    values = 0.0
+    def new_binary(name: str) -> Any:
+        variable = xp.var(vartype=xp.binary, name=name)
+        problem.addVariable(variable)
+        return variable
 
-    # Creates the decision variables and adds them to the linear sums.
-    items = []
-    for item in input_data["items"]:
-        item_variable = xp.var(vartype=xp.binary, name=item["id"])
-        problem.addVariable(item_variable)
-        items.append({"item": item, "variable": item_variable})
-        weights += item_variable * item["weight"]
-        values += item_variable * item["value"]
+    def add_constraint(constraint: Any) -> Any:
+        problem.addConstraint(constraint)
+        return constraint
 
-    # This constraint ensures the weight capacity of the knapsack will not be
-    # exceeded.
-    problem.addConstraint(weights <= input_data["weight_capacity"])
+    model = build_model(input_data, new_binary, add_constraint)
 
     # Sets the objective function: maximize the value of the chosen items.
-    problem.setObjective(values, sense=xp.maximize)
+    problem.setObjective(model["objective"], sense=xp.maximize)
+
+    # The MIP has no meaningful duals, so they are taken from the LP
+    # relaxation, which is solved first if requested.
+    relaxation_duals = None
+    if duals:
+        relaxation_duals = solve_relaxation(problem, model["capacity_constraints"], model["items"], model["several"])
 
     # Solves the problem.
     _, status = problem.optimize()
 
-    # Determines which items were chosen.
-    chosen_items = [item["item"] for item in items if problem.getSolution(item["variable"]) > 0.9]
+    # Without a solution, e.g. if the problem is infeasible, no items are
+    # chosen and there is no value.
+    has_solution = status in (xp.SolStatus.OPTIMAL, xp.SolStatus.FEASIBLE)
 
     # Creates the statistics.
     statistics = {
@@ -98,7 +161,7 @@ def solve(input_data: dict[str, Any], duration: int) -> dict[str, Any]:
                 "variables": problem.getAttrib("cols"),
             },
             "duration": problem.getAttrib("time"),
-            "value": problem.getAttrib("objval"),
+            "value": problem.getAttrib("objval") if has_solution else None,
         },
         "run": {
             "duration": problem.getAttrib("time"),
@@ -106,12 +169,163 @@ def solve(input_data: dict[str, Any], duration: int) -> dict[str, Any]:
         "schema": "v1",
     }
 
+    if relaxation_duals is not None:
+        statistics["result"]["custom"]["duals"] = relaxation_duals
+
+    return {
+        "solutions": [{"items": chosen_items(model, problem.getSolution) if has_solution else []}],
+        "statistics": statistics,
+    }
+
+
+def solve_scip(input_data: dict[str, Any], duration: int, duals: bool) -> dict[str, Any]:
+    """
+    Solves the given problem with the open-source SCIP solver of OR-Tools and
+    returns the solution. It is the fallback for when no full Xpress license is
+    present and solves the same model as Xpress.
+    """
+
+    # Duals are taken from the LP relaxation solved by Xpress.
+    if duals:
+        log("Note: the duals are only reported when solving with xpress, they are omitted.")
+
+    # Creates the solver.
+    solver = pywraplp.Solver.CreateSolver("SCIP")
+    solver.SetTimeLimit(duration * 1000)
+
+    model = build_model(input_data, lambda name: solver.IntVar(0, 1, name), solver.Add)
+
+    # Sets the objective function: maximize the value of the chosen items.
+    solver.Maximize(model["objective"])
+
+    # Solves the problem.
+    status = solver.Solve()
+
+    # Creates the statistics.
+    statistics = {
+        "result": {
+            "custom": {
+                "constraints": solver.NumConstraints(),
+                "provider": "scip",
+                "status": SCIP_STATUS.get(status, "unknown"),
+                "variables": solver.NumVariables(),
+            },
+            "duration": solver.WallTime() / 1000,
+            "value": solver.Objective().Value(),
+        },
+        "run": {
+            "duration": solver.WallTime() / 1000,
+        },
+        "schema": "v1",
+    }
+
     return {
-        "solutions": [{"items": chosen_items}],
+        "solutions": [{"items": chosen_items(model, lambda variable: variable.solution_value())}],
         "statistics": statistics,
     }
 
 
+def build_model(
+    input_data: dict[str, Any],
+    new_binary: Callable[[str], Any],
+    add_constraint: Callable[[Any], Any],
+) -> dict[str, Any]:
+    """
+    Builds the knapsack model of the input with the binary variables created
+    by new_binary and the constraints added by add_constraint, which returns
+    the added constraint. Both solvers build their model with it, so they
+    solve the same problem. Returns the items with their variables, the
+    capacity constraints, the objective to maximize and whether there are
+    several knapsacks.
+    """
+
+    # Several knapsacks are given by their capacities, otherwise there is a
+    # single knapsack with the weight capacity.
+    several = "capacities" in input_data
+    capacities = input_data["capacities"] if several else [input_data["weight_capacity"]]
+
+    # Initializes the linear sums, the weights per knapsack.
+    weights = [0.0 for _ in capacities]
+    values = 0.0
+
+    # Creates the decision variables, one per item and knapsack, and adds them
+    # to the linear sums.
+    items = []
+    for item in input_data["items"]:
+        item_variables = []
+        for k in range(len(capacities)):
+            name = f"{item['id']}_{k}" if several else item["id"]
+            item_variable = new_binary(name)
+            item_variables.append(item_variable)
+            weights[k] += item_variable * item["weight"]
+            values += item_variable * item["value"]
+        items.append({"item": item, "variables": item_variables})
+
+        # With several knapsacks, an item is packed into at most one of them.
+        if several:
+            add_constraint(sum(item_variables) <= 1)
+
+    # These constraints ensure the weight capacity of the knapsacks will not be
+    # exceeded.
+    capacity_constraints = [add_constraint(weights[k] <= capacity) for k, capacity in enumerate(capacities)]
+
+    return {
+        "items": items,
+        "capacity_constraints": capacity_constraints,
+        "objective": values,
+        "several": several,
+    }
+
+
+def chosen_items(model: dict[str, Any], solution_value: Callable[[Any], float]) -> list[dict[str, Any]]:
+    """
+    Returns the items chosen in the solution, given by the solution value of
+    every variable, and, with several knapsacks, which knapsack they are
+    packed into.
+    """
+
+    chosen = []
+    for item in model["items"]:
+        for k, item_variable in enumerate(item["variables"]):
+            if solution_value(item_variable) > 0.9:
+                chosen.append({**item["item"], "knapsack_id": k} if model["several"] else item["item"])
+
+    return chosen
+
+
+def solve_relaxation(
+    problem: Any,
+    capacity_constraints: list[Any],
+    items: list[dict[str, Any]],
+    several: bool,
+) -> dict[str, Any] | None:
+    """
+    Solves the LP relaxation of the problem and returns the shadow price of the
+    weight capacity, i.e. the value of one more unit of capacity, and the
+    reduced costs of the items. With several knapsacks, they are lists with an
+    entry per knapsack and the shadow prices are reported as capacities. If
+    the relaxation is not solved to optimality, its duals are not meaningful
+    and None is returned.
+    """
+
+    problem.lpoptimize()
+    if problem.getAttrib("lpstatus") != xp.LPStatus.OPTIMAL:
+        log("Note: the LP relaxation was not solved to optimality, its duals are omitted.")
+        return None
+
+    shadow_prices = [problem.getDual(constraint) for constraint in capacity_constraints]
+    reduced_costs = {
+        item["item"]["id"]: [problem.getRCost(item_variable) for item_variable in item["variables"]] for item in items
+    }
+    if several:
+        return {"capacities": shadow_prices, "reduced_costs": reduced_costs}
+
+    return {
+        "capacity": shadow_prices[0],
+        "reduced_costs": {item_id: costs[0] for item_id, costs in reduced_costs.items()},
+    }
+
+
 def log(message: str) -> None:
     """Logs a message. We need to use stderr since stdout is used for the
     solution."""